@@ -25,30 +25,46 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	e2types "github.com/wealdtech/go-eth2-types/v2"
-	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	util "github.com/wealdtech/go-eth2-util"
 	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
 )
 
+// blsWithdrawalPrefix is the prefix for BLS withdrawal credentials.
+const blsWithdrawalPrefix = byte(0x00)
+
 // account contains the details of the account.
 type account struct {
-	id         uuid.UUID
-	name       string
-	publicKey  e2types.PublicKey
-	crypto     map[string]interface{}
-	secretKey  e2types.PrivateKey
-	version    uint
-	path       string
-	wallet     e2wtypes.Wallet
-	encryptor  e2wtypes.Encryptor
-	mutex      *sync.RWMutex
+	id        uuid.UUID
+	name      string
+	publicKey e2types.PublicKey
+	crypto    map[string]interface{}
+	secretKey e2types.PrivateKey
+	version   uint
+	path      string
+	wallet    e2wtypes.Wallet
+	encryptor e2wtypes.Encryptor
+	// mutex protects the account's lock state and its stored data.
+	mutex      sync.RWMutex
 	keyService *keyService
+	// local is true if the account does not have a remote share.
+	local bool
+	// signingAccount is the ID of the signing account for a withdrawal account.
+	signingAccount uuid.UUID
+	// withdrawalAccount is the ID of the withdrawal account for a signing account.
+	withdrawalAccount uuid.UUID
+	// archived is true if the account has been archived, and so cannot be unlocked.
+	archived bool
+	// programmatic is true if the account was calculated from its path, and so is not stored.
+	programmatic bool
+	// autoLock locks the account automatically after its timeouts.
+	autoLock *autoLock
 }
 
 // newAccount creates a new account
 func newAccount() *account {
-	return &account{
-		mutex: new(sync.RWMutex),
-	}
+	a := &account{}
+	a.autoLock = newAutoLock(a.autoLocked)
+	return a
 }
 
 // MarshalJSON implements custom JSON marshaller.
@@ -60,6 +76,21 @@ func (a *account) MarshalJSON() ([]byte, error) {
 	data["crypto"] = a.crypto
 	data["path"] = a.path
 	data["version"] = a.version
+	if a.encryptor != nil {
+		data["encryptor"] = a.encryptor.Name()
+	}
+	if a.local {
+		data["local"] = true
+	}
+	if a.signingAccount != uuid.Nil {
+		data["signingaccount"] = a.signingAccount.String()
+	}
+	if a.withdrawalAccount != uuid.Nil {
+		data["withdrawalaccount"] = a.withdrawalAccount.String()
+	}
+	if a.archived {
+		data["archived"] = true
+	}
 	return json.Marshal(data)
 }
 
@@ -147,12 +178,56 @@ func (a *account) UnmarshalJSON(data []byte) error {
 	} else {
 		return errors.New("account version missing")
 	}
-	// Only support keystorev4 at current...
-	if a.version == 4 {
-		a.encryptor = keystorev4.New()
-	} else {
-		return errors.New("unsupported keystore version")
+	if val, exists := v["local"]; exists {
+		local, ok := val.(bool)
+		if !ok {
+			return errors.New("account local invalid")
+		}
+		a.local = local
+	}
+	if val, exists := v["signingaccount"]; exists {
+		idStr, ok := val.(string)
+		if !ok {
+			return errors.New("account signing account invalid")
+		}
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return err
+		}
+		a.signingAccount = id
+	}
+	if val, exists := v["withdrawalaccount"]; exists {
+		idStr, ok := val.(string)
+		if !ok {
+			return errors.New("account withdrawal account invalid")
+		}
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return err
+		}
+		a.withdrawalAccount = id
+	}
+	if val, exists := v["archived"]; exists {
+		archived, ok := val.(bool)
+		if !ok {
+			return errors.New("account archived invalid")
+		}
+		a.archived = archived
+	}
+	encryptorName := legacyEncryptorName
+	if val, exists := v["encryptor"]; exists {
+		name, ok := val.(string)
+		if !ok {
+			return errors.New("account encryptor invalid")
+		}
+		encryptorName = name
+	}
+	// Any encryptor already set is that of the wallet, which is preferred if it protected this account.
+	encryptor, err := resolveEncryptor(a.encryptor, encryptorName, a.version)
+	if err != nil {
+		return err
 	}
+	a.encryptor = encryptor
 
 	return nil
 }
@@ -168,9 +243,13 @@ func (a *account) Name() string {
 }
 
 // PublicKey provides the public key for the account.
+// This is the aggregate of the local and remote public keys, or the local public key for a local account.
 func (a *account) PublicKey() e2types.PublicKey {
 	// Create a copy since Aggreate() modifies the public key
 	localKeyCopy := a.publicKey.Copy()
+	if a.local {
+		return localKeyCopy
+	}
 
 	remoteKey, err := a.keyService.PublicKey()
 	if err != nil {
@@ -191,7 +270,20 @@ func (a *account) PrivateKey(ctx context.Context) (e2types.PrivateKey, error) {
 		return nil, err
 	}
 	if !unlocked {
-		return nil, errors.New("cannot provide private key when account is locked")
+		return nil, newError(ErrLocked, "cannot provide private key when account is locked")
+	}
+
+	a.autoLock.touch()
+	if a.local {
+		a.mutex.RLock()
+		secretKey := a.secretKey
+		a.mutex.RUnlock()
+		if secretKey == nil {
+			return nil, newError(ErrLocked, "cannot provide private key when account is locked")
+		}
+		secretBytes := secretKey.Marshal()
+		defer zeroize(secretBytes)
+		return e2types.BLSPrivateKeyFromBytes(secretBytes)
 	}
 
 	sk, err := a.keyService.PrivateKey()
@@ -199,7 +291,9 @@ func (a *account) PrivateKey(ctx context.Context) (e2types.PrivateKey, error) {
 		return nil, err
 	}
 
-	return e2types.BLSPrivateKeyFromBytes(sk.Marshal())
+	secretBytes := sk.Marshal()
+	defer zeroize(secretBytes)
+	return e2types.BLSPrivateKeyFromBytes(secretBytes)
 }
 
 // Wallet provides the wallet for the account.
@@ -210,34 +304,85 @@ func (a *account) Wallet() e2wtypes.Wallet {
 // Lock locks the account.  A locked account cannot sign data.
 func (a *account) Lock(ctx context.Context) error {
 	a.mutex.Lock()
-	defer a.mutex.Unlock()
-	a.secretKey = nil
+	locked := a.lock()
+	a.mutex.Unlock()
+	if w, isWallet := a.wallet.(*wallet); isWallet && locked {
+		w.notifyLockEvent(&LockEvent{AccountID: a.id, Reason: LockReasonExplicit})
+	}
 	return nil
 }
 
+// lock locks the account, returning true if it was unlocked.
+// This is an internal function, that assumes a lock is held on the account.
+func (a *account) lock() bool {
+	a.autoLock.stop()
+	if a.secretKey == nil {
+		return false
+	}
+	a.secretKey = nil
+	if w, isWallet := a.wallet.(*wallet); isWallet && !a.programmatic {
+		w.accountLocked(a)
+	}
+	return true
+}
+
 // Unlock unlocks the account.  An unlocked account can sign data.
+// Archived and deleted accounts cannot be unlocked.
 func (a *account) Unlock(ctx context.Context, passphrase []byte) error {
+	unlocked, err := a.unlock(passphrase)
+	if err != nil {
+		return err
+	}
+	if w, isWallet := a.wallet.(*wallet); isWallet && unlocked {
+		w.notifyLockEvent(&LockEvent{AccountID: a.id, Unlocked: true})
+	}
+	return nil
+}
+
+// unlock unlocks the account, returning true if it was locked.
+func (a *account) unlock(passphrase []byte) (bool, error) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
+	if a.archived {
+		return false, newError(ErrArchived, "account is archived")
+	}
+	w, isWallet := a.wallet.(*wallet)
+	if isWallet {
+		if err := w.checkAccountRetired(a.id); err != nil {
+			return false, err
+		}
+	}
+
 	secretBytes, err := a.encryptor.Decrypt(a.crypto, string(passphrase))
 	if err != nil {
-		return errors.New("incorrect passphrase")
+		return false, newError(ErrIncorrectPassphrase, "incorrect passphrase")
 	}
+	defer zeroize(secretBytes)
 	secretKey, err := e2types.BLSPrivateKeyFromBytes(secretBytes)
 	if err != nil {
-		return err
+		return false, err
 	}
 	publicKey := secretKey.PublicKey()
 	if !bytes.Equal(publicKey.Marshal(), a.publicKey.Marshal()) {
-		return errors.New("secret key does not correspond to public key")
+		return false, newError(ErrCorruptData, "secret key does not correspond to public key")
+	}
+	wasLocked := a.secretKey == nil
+	if wasLocked && isWallet && !a.programmatic {
+		w.accountUnlocked(a)
 	}
 	a.secretKey = secretKey
-	return nil
+	if isWallet {
+		a.autoLock.inherit(w.accountsAutoLock())
+	}
+	a.autoLock.start()
+	return wasLocked, nil
 }
 
 // IsUnlocked returns true if the account is unlocked.
 func (a *account) IsUnlocked(ctx context.Context) (bool, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
 	return a.secretKey != nil, nil
 }
 
@@ -246,31 +391,103 @@ func (a *account) Path() string {
 	return a.path
 }
 
+// IsLocal returns true if the account is held entirely locally, without a remote share.
+func (a *account) IsLocal() bool {
+	return a.local
+}
+
+// IsArchived returns true if the account has been archived, and so cannot be unlocked.
+func (a *account) IsArchived() bool {
+	return a.archived
+}
+
+// SigningAccountID returns the ID of the signing account for a withdrawal account.
+// This will be uuid.Nil if the account is not a withdrawal account.
+func (a *account) SigningAccountID() uuid.UUID {
+	return a.signingAccount
+}
+
+// WithdrawalAccountID returns the ID of the withdrawal account for a signing account.
+// This will be uuid.Nil if the account does not have a withdrawal account.
+func (a *account) WithdrawalAccountID() uuid.UUID {
+	return a.withdrawalAccount
+}
+
+// WithdrawalCredentials returns the BLS withdrawal credentials for the account's public key.
+// This is usually called on a withdrawal account, with the result used in the deposit for its signing account.
+func (a *account) WithdrawalCredentials() ([]byte, error) {
+	publicKey := a.PublicKey()
+	if publicKey == nil {
+		return nil, errors.New("failed to obtain public key")
+	}
+	withdrawalCredentials := util.SHA256(publicKey.Marshal())
+	withdrawalCredentials[0] = blsWithdrawalPrefix
+	return withdrawalCredentials, nil
+}
+
+// remoteSignResult is the result of a signing request to the key service.
+type remoteSignResult struct {
+	signature e2types.Signature
+	err       error
+}
+
 // Sign signs data.
+// The local and remote signatures are generated concurrently, and the account lock is only held
+// whilst obtaining the secret key so that the account can be locked during a key service request.
+// Requests in progress complete if the account is locked, and the account is not locked for being idle until they do.
+// If the account's key service uses the Web3Signer protocol the context must supply the details of the request with
+// WithWeb3SignerRequest(), otherwise an ErrUnsupportedRequest error is returned.
 func (a *account) Sign(ctx context.Context, data []byte) (e2types.Signature, error) {
 	a.mutex.RLock()
-	defer a.mutex.RUnlock()
-	unlocked, err := a.IsUnlocked(ctx)
-	if err != nil {
-		return nil, err
+	secretKey := a.secretKey
+	a.mutex.RUnlock()
+	if secretKey == nil {
+		return nil, newError(ErrLocked, "cannot sign when account is locked")
 	}
-	if !unlocked {
-		return nil, errors.New("cannot sign when account is locked")
+	if !a.local {
+		if err := a.keyService.checkRequest(ctx); err != nil {
+			return nil, err
+		}
 	}
-	localSignature := a.secretKey.Sign(data)
+	a.autoLock.begin()
+	defer a.autoLock.end()
 
-	remoteSignature, err := a.keyService.Sign(data)
-	if err != nil {
-		return nil, err
+	if a.local {
+		return secretKey.Sign(data), nil
+	}
+
+	// Buffered so that the request can complete even if we stop waiting for it.
+	remoteCh := make(chan *remoteSignResult, 1)
+	go func() {
+		signature, err := a.keyService.Sign(ctx, data)
+		remoteCh <- &remoteSignResult{
+			signature: signature,
+			err:       err,
+		}
+	}()
+
+	localSignature := secretKey.Sign(data)
+
+	var remote *remoteSignResult
+	select {
+	case remote = <-remoteCh:
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "remote signature not obtained")
+	}
+	if remote.err != nil {
+		return nil, remote.err
 	}
 
-	return e2types.AggregateSignatures([]e2types.Signature{localSignature, remoteSignature}), nil
+	return e2types.AggregateSignatures([]e2types.Signature{localSignature, remote.signature}), nil
 }
 
 // storeAccount stores the account.
 func (a *account) storeAccount() error {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
+	if a.programmatic {
+		return errors.New("programmatic accounts cannot be stored")
+	}
 	data, err := json.Marshal(a)
 	if err != nil {
 		return err
@@ -289,9 +506,14 @@ func deserializeAccount(w *wallet, data []byte) (e2wtypes.Account, error) {
 	a := newAccount()
 	a.wallet = w
 	a.encryptor = w.encryptor
-	a.keyService = w.keyService
 	if err := json.Unmarshal(data, a); err != nil {
-		return nil, err
+		if errors.Is(err, ErrUnsupportedVersion) {
+			return nil, err
+		}
+		return nil, markError(ErrCorruptData, err)
+	}
+	if !a.local {
+		a.keyService = w.keyService
 	}
 	return a, nil
 }
@@ -24,6 +24,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -158,6 +159,31 @@ func TestUnmarshalAccount(t *testing.T) {
 			input: []byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":3,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0"}`),
 			err:   errors.New(`unsupported keystore version`),
 		},
+		{
+			name:  "BadLocal",
+			input: []byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0","local":"true"}`),
+			err:   errors.New(`account local invalid`),
+		},
+		{
+			name:  "WrongSigningAccount",
+			input: []byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0","signingaccount":1}`),
+			err:   errors.New(`account signing account invalid`),
+		},
+		{
+			name:  "BadSigningAccount",
+			input: []byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0","signingaccount":"bad"}`),
+			err:   errors.New(`invalid UUID length: 3`),
+		},
+		{
+			name:  "WrongWithdrawalAccount",
+			input: []byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0","withdrawalaccount":1}`),
+			err:   errors.New(`account withdrawal account invalid`),
+		},
+		{
+			name:  "BadWithdrawalAccount",
+			input: []byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0","withdrawalaccount":"bad"}`),
+			err:   errors.New(`invalid UUID length: 3`),
+		},
 		{
 			name:       "Good",
 			input:      []byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0"}`),
@@ -281,3 +307,118 @@ func TestUnlock(t *testing.T) {
 		})
 	}
 }
+
+func TestSignConcurrentLock(t *testing.T) {
+	remoteSignature := _signature("8418d830acbbd4a4bffec2a449a97c04779a146eaf3fecaee16f6a554a3179c2233e6ff407915e6598365a1059da11ff1013232fdf0bb93ea2a88968fd2d7c2d97f87c789faecea044973075628b9e4f8b6a4a69c4919752f414a807936c208b")
+
+	// Start a local HTTP server that holds requests until released.
+	received := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		close(received)
+		<-release
+		rw.Write([]byte(fmt.Sprintf(`{"sign":"%x"}`, remoteSignature.Marshal())))
+	}))
+	defer server.Close()
+
+	account := newAccount()
+	err := json.Unmarshal([]byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0"}`), account)
+	require.NoError(t, err)
+	account.keyService = newKeyService()
+	err = json.Unmarshal([]byte(fmt.Sprintf(`{"url": "%s", "pubkey": "868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2", "version": 1}`, server.URL)), account.keyService)
+	require.NoError(t, err)
+	require.NoError(t, account.Unlock(context.Background(), []byte("test passphrase")))
+
+	signed := make(chan error, 1)
+	go func() {
+		_, err := account.Sign(context.Background(), []byte("test"))
+		signed <- err
+	}()
+
+	// Lock the account whilst the key service request is outstanding; should not block.
+	<-received
+	locked := make(chan struct{})
+	go func() {
+		require.NoError(t, account.Lock(context.Background()))
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock blocked by outstanding signing request")
+	}
+
+	// The outstanding request should still complete.
+	close(release)
+	require.NoError(t, <-signed)
+
+	// Further requests should fail as the account is locked.
+	_, err = account.Sign(context.Background(), []byte("test"))
+	assert.Error(t, err)
+}
+
+func TestSignCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	account := newAccount()
+	err := json.Unmarshal([]byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0"}`), account)
+	require.NoError(t, err)
+	account.keyService = newKeyService()
+	err = json.Unmarshal([]byte(fmt.Sprintf(`{"url": "%s", "pubkey": "868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2", "version": 1}`, server.URL)), account.keyService)
+	require.NoError(t, err)
+	require.NoError(t, account.Unlock(context.Background(), []byte("test passphrase")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = account.Sign(ctx, []byte("test"))
+	require.EqualError(t, err, "remote signature not obtained: context deadline exceeded")
+}
+
+func TestSignIdleAutoLock(t *testing.T) {
+	remoteSignature := _signature("8418d830acbbd4a4bffec2a449a97c04779a146eaf3fecaee16f6a554a3179c2233e6ff407915e6598365a1059da11ff1013232fdf0bb93ea2a88968fd2d7c2d97f87c789faecea044973075628b9e4f8b6a4a69c4919752f414a807936c208b")
+
+	// Start a local HTTP server that holds requests until released.
+	received := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		close(received)
+		<-release
+		rw.Write([]byte(fmt.Sprintf(`{"sign":"%x"}`, remoteSignature.Marshal())))
+	}))
+	defer server.Close()
+
+	account := newAccount()
+	err := json.Unmarshal([]byte(`{"uuid":"c9958061-63d4-4a80-bcf3-25f3dda22340","name":"test account","pubkey":"a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c","version":4,"crypto":{"checksum":{"function":"sha256","message":"09b65fda487a021900003a8b2081694b15ca73e0e59a5c79a5126f6818a2f171","params":{}},"cipher":{"function":"aes-128-ctr","message":"8386db98fbe002c02de9bc122b7680078045bf6c5c9ac2f7e8b53afbea0d3e15","params":{"iv":"45092570c625ad5e8decfcd991464740"}},"kdf":{"function":"pbkdf2","message":"","params":{"c":16,"dklen":32,"prf":"hmac-sha256","salt":"ae6433afd822e6d99dfaa1a0d73d2ee263efdf62f858ba0c422cf27982d09c8a"}}},"path":"m/12381/3600/0/0"}`), account)
+	require.NoError(t, err)
+	account.keyService = newKeyService()
+	err = json.Unmarshal([]byte(fmt.Sprintf(`{"url": "%s", "pubkey": "868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2", "version": 1}`, server.URL)), account.keyService)
+	require.NoError(t, err)
+	require.NoError(t, account.SetAutoLock(50*time.Millisecond, 0))
+	require.NoError(t, account.Unlock(context.Background(), []byte("test passphrase")))
+
+	signed := make(chan error, 1)
+	go func() {
+		_, err := account.Sign(context.Background(), []byte("test"))
+		signed <- err
+	}()
+
+	// The idle timeout does not pass whilst the key service request is outstanding.
+	<-received
+	time.Sleep(150 * time.Millisecond)
+	unlocked, err := account.IsUnlocked(context.Background())
+	require.NoError(t, err)
+	assert.True(t, unlocked)
+
+	// Once the request completes the idle timeout starts afresh.
+	close(release)
+	require.NoError(t, <-signed)
+	assert.Eventually(t, func() bool {
+		unlocked, _ := account.IsUnlocked(context.Background())
+		return !unlocked
+	}, 5*time.Second, 10*time.Millisecond)
+}
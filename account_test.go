@@ -17,14 +17,20 @@ package mpc_test
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
 	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
-	scratch "github.com/wealdtech/go-eth2-wallet-store-scratch"
 	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
 )
 
@@ -34,6 +40,20 @@ func _byteArray(input string) []byte {
 	return x
 }
 
+// _keyService is a helper to start a key service that signs with the supplied private key.
+func _keyService(t *testing.T, privateKey e2types.PrivateKey) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal(t, fmt.Sprintf("%x", privateKey.PublicKey().Marshal()), strings.TrimPrefix(req.URL.Path, "/"))
+		var request struct {
+			Payload string `json:"payload"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		payload, err := hex.DecodeString(request.Payload)
+		require.NoError(t, err)
+		rw.Write([]byte(fmt.Sprintf(`{"sign":"%x"}`, privateKey.Sign(payload).Marshal())))
+	}))
+}
+
 func TestCreateAccount(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -146,6 +166,59 @@ func TestAccountByNameDynamic(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestProgrammaticAccount(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, keyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	accountByNameProvider := wallet.(e2wtypes.WalletAccountByNameProvider)
+
+	// Programmatic accounts cannot be calculated whilst the wallet is locked.
+	_, err = accountByNameProvider.AccountByName(context.Background(), "m/12381/3600/0/0")
+	assert.True(t, errors.Is(err, mpc.ErrLocked))
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := accountByNameProvider.AccountByName(context.Background(), "m/12381/3600/0/0")
+	require.NoError(t, err)
+	require.NotNil(t, account.PublicKey())
+
+	// The account has the same public key as a stored account with the same path.
+	stored, err := wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/0/0", "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, stored.PublicKey().Marshal(), account.PublicKey().Marshal())
+
+	// The account signs with both its local and remote shares.
+	data := _byteArray("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	signature, err := account.(e2wtypes.AccountSigner).Sign(context.Background(), data)
+	require.NoError(t, err)
+	assert.True(t, signature.Verify(data, account.PublicKey()))
+
+	// The account can be locked, and unlocked again with an empty passphrase.
+	require.NoError(t, account.(e2wtypes.AccountLocker).Lock(context.Background()))
+	_, err = account.(e2wtypes.AccountSigner).Sign(context.Background(), data)
+	assert.NotNil(t, err)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), nil))
+	_, err = account.(e2wtypes.AccountSigner).Sign(context.Background(), data)
+	assert.NoError(t, err)
+
+	// The account is not stored.
+	err = account.(passphraseChanger).ChangePassphrase(context.Background(), nil, []byte("new passphrase"))
+	assert.EqualError(t, err, "programmatic accounts are not stored, so their passphrase cannot be changed")
+	_, err = wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), account.ID())
+	assert.True(t, errors.Is(err, mpc.ErrNotFound))
+}
+
 func TestCreatePathedAccount(t *testing.T) {
 	store := scratch.New()
 	encryptor := keystorev4.New()
@@ -177,6 +250,16 @@ func TestCreatePathedAccount(t *testing.T) {
 	// Attempt to create an account with the the same path; should fail.
 	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/1/2/3", "Test 4", []byte("account passphrase"))
 	require.EqualError(t, err, `account with path "m/12381/3600/1/2/3" already exists`)
+
+	// Attempt to create accounts with invalid paths; should fail.
+	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "12381/3600/2/0", "Test 5", []byte("account passphrase"))
+	require.EqualError(t, err, `path "12381/3600/2/0" must start with m/`)
+	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/02/0", "Test 5", []byte("account passphrase"))
+	require.EqualError(t, err, `path "m/12381/3600/02/0" has invalid component "02"`)
+	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/2/", "Test 5", []byte("account passphrase"))
+	require.EqualError(t, err, `path "m/12381/3600/2/" has invalid component ""`)
+	_, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "m/12381/3600/2'/0")
+	require.EqualError(t, err, `path "m/12381/3600/2'/0" has invalid component "2'"`)
 }
 
 func TestCreatePathedAccountConflict(t *testing.T) {
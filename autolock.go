@@ -0,0 +1,315 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// LockReason is the reason that a wallet or account was locked.
+type LockReason string
+
+const (
+	// LockReasonExplicit is the reason when Lock() is called.
+	LockReasonExplicit LockReason = "explicit"
+	// LockReasonIdle is the reason when a wallet or account has not been used for its idle timeout.
+	LockReasonIdle LockReason = "idle"
+	// LockReasonExpired is the reason when a wallet or account has been unlocked for its absolute timeout.
+	LockReasonExpired LockReason = "expired"
+)
+
+// LockEvent is a transition of a wallet or account between locked and unlocked.
+type LockEvent struct {
+	// WalletID is the ID of the wallet.
+	WalletID uuid.UUID
+	// AccountID is the ID of the account, or uuid.Nil if the event is for the wallet itself.
+	AccountID uuid.UUID
+	// Unlocked is true if the wallet or account was unlocked, and false if it was locked.
+	Unlocked bool
+	// Reason is the reason that the wallet or account was locked.  It is empty when unlocked.
+	Reason LockReason
+}
+
+// LockObserver is called after a wallet or one of its accounts is locked or unlocked.
+// It is called synchronously, without any locks held, so must not block for long.
+type LockObserver func(event *LockEvent)
+
+// SetAutoLock sets the timeouts after which the wallet is locked automatically.  The wallet is locked when it has
+// not been used to create or verify accounts for the idle timeout, or when it has been unlocked for the absolute
+// timeout.  A zero timeout is disabled, which is the default.  If the wallet is unlocked the timeouts start afresh.
+// Auto-lock settings are not stored with the wallet, so only apply to this instance.
+func (w *wallet) SetAutoLock(idle time.Duration, absolute time.Duration) error {
+	if err := checkAutoLock(idle, absolute); err != nil {
+		return err
+	}
+	w.autoLock.set(idle, absolute)
+	return nil
+}
+
+// SetAccountsAutoLock sets the default timeouts after which accounts obtained from this instance of the wallet are
+// locked automatically, for accounts that do not have their own timeouts set.  The defaults apply from the next
+// time that each account is unlocked.
+func (w *wallet) SetAccountsAutoLock(idle time.Duration, absolute time.Duration) error {
+	if err := checkAutoLock(idle, absolute); err != nil {
+		return err
+	}
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	w.accountsIdle = idle
+	w.accountsAbsolute = absolute
+	return nil
+}
+
+// SetLockObserver sets the observer that is called when the wallet or one of the accounts obtained from this
+// instance of the wallet is locked or unlocked.  A nil observer removes the existing observer.
+func (w *wallet) SetLockObserver(observer LockObserver) {
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	w.lockObserver = observer
+}
+
+// SetAutoLock sets the timeouts after which the account is locked automatically.  The account is locked when it has
+// not signed for the idle timeout, or when it has been unlocked for the absolute timeout.  A zero timeout is disabled.
+// These override the wallet's defaults for its accounts.  If the account is unlocked the timeouts start afresh.
+func (a *account) SetAutoLock(idle time.Duration, absolute time.Duration) error {
+	if err := checkAutoLock(idle, absolute); err != nil {
+		return err
+	}
+	a.autoLock.set(idle, absolute)
+	return nil
+}
+
+// checkAutoLock checks auto-lock timeouts.
+func checkAutoLock(idle time.Duration, absolute time.Duration) error {
+	if idle < 0 {
+		return errors.New("idle timeout must not be negative")
+	}
+	if absolute < 0 {
+		return errors.New("absolute timeout must not be negative")
+	}
+	return nil
+}
+
+// accountsAutoLock returns the default auto-lock timeouts for accounts.
+func (w *wallet) accountsAutoLock() (time.Duration, time.Duration) {
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	return w.accountsIdle, w.accountsAbsolute
+}
+
+// notifyLockEvent passes an event to the lock observer, if there is one.
+func (w *wallet) notifyLockEvent(event *LockEvent) {
+	w.accountsMutex.Lock()
+	observer := w.lockObserver
+	w.accountsMutex.Unlock()
+	if observer != nil {
+		event.WalletID = w.id
+		observer(event)
+	}
+}
+
+// autoLocked locks the wallet when a timeout of the given unlocked session has passed.
+func (w *wallet) autoLocked(session uint64, reason LockReason) {
+	w.mutex.Lock()
+	if !w.autoLock.current(session) {
+		// Locked or unlocked again since the timeout passed.
+		w.mutex.Unlock()
+		return
+	}
+	w.clearSeed()
+	w.autoLock.stop()
+	w.mutex.Unlock()
+	w.notifyLockEvent(&LockEvent{Reason: reason})
+}
+
+// autoLocked locks the account when a timeout of the given unlocked session has passed.
+func (a *account) autoLocked(session uint64, reason LockReason) {
+	a.mutex.Lock()
+	if !a.autoLock.current(session) {
+		// Locked or unlocked again since the timeout passed.
+		a.mutex.Unlock()
+		return
+	}
+	locked := a.lock()
+	a.mutex.Unlock()
+	if w, isWallet := a.wallet.(*wallet); isWallet && locked {
+		w.notifyLockEvent(&LockEvent{AccountID: a.id, Reason: reason})
+	}
+}
+
+// autoLock tracks the timeouts of an unlocked wallet or account.
+// Each unlock starts a session, and the timer only locks if its session is still current, so that a timeout that
+// passes as the wallet or account is locked or unlocked again has no effect.
+type autoLock struct {
+	mutex sync.Mutex
+	// configured is true if the timeouts have been set explicitly.
+	configured bool
+	idle       time.Duration
+	absolute   time.Duration
+	// session is the current unlocked session, or 0 if locked.
+	session     uint64
+	lastSession uint64
+	expires     time.Time
+	lastUsed    time.Time
+	// inUse is the number of operations in progress, during which the idle timeout does not pass.
+	inUse int
+	timer *time.Timer
+	// lock locks when a timeout of the given session has passed.  It is called without the mutex held.
+	lock func(session uint64, reason LockReason)
+}
+
+// newAutoLock creates an auto-lock with the given lock function.
+func newAutoLock(lock func(session uint64, reason LockReason)) *autoLock {
+	return &autoLock{
+		lock: lock,
+	}
+}
+
+// set sets the timeouts, restarting them if there is a current session.
+func (l *autoLock) set(idle time.Duration, absolute time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.configured = true
+	l.idle = idle
+	l.absolute = absolute
+	if l.session != 0 {
+		l.restart()
+	}
+}
+
+// inherit sets the timeouts if they have not been set explicitly.
+func (l *autoLock) inherit(idle time.Duration, absolute time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.configured {
+		l.idle = idle
+		l.absolute = absolute
+	}
+}
+
+// start starts a new session.
+func (l *autoLock) start() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lastSession++
+	l.session = l.lastSession
+	l.restart()
+}
+
+// stop ends the current session.
+func (l *autoLock) stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.session = 0
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+}
+
+// touch records use, postponing the idle timeout.
+func (l *autoLock) touch() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.session != 0 {
+		l.lastUsed = time.Now()
+	}
+}
+
+// begin records the start of an operation, during which the idle timeout does not pass.
+func (l *autoLock) begin() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inUse++
+	l.lastUsed = time.Now()
+}
+
+// end records the end of an operation, after which the idle timeout starts afresh.
+func (l *autoLock) end() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inUse--
+	l.lastUsed = time.Now()
+	if l.inUse == 0 && l.session != 0 && l.idle > 0 {
+		l.schedule(l.lastUsed)
+	}
+}
+
+// current returns true if the given session is current.
+func (l *autoLock) current(session uint64) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return session != 0 && l.session == session
+}
+
+// restart starts the timeouts afresh.  This assumes that the mutex is held.
+func (l *autoLock) restart() {
+	now := time.Now()
+	l.lastUsed = now
+	l.expires = now.Add(l.absolute)
+	l.schedule(now)
+}
+
+// schedule sets the timer for the next timeout.  This assumes that the mutex is held.
+func (l *autoLock) schedule(now time.Time) {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	var next time.Time
+	if l.absolute > 0 {
+		next = l.expires
+	}
+	if l.idle > 0 && l.inUse == 0 {
+		idleExpires := l.lastUsed.Add(l.idle)
+		if next.IsZero() || idleExpires.Before(next) {
+			next = idleExpires
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	session := l.session
+	l.timer = time.AfterFunc(next.Sub(now), func() {
+		l.fire(session)
+	})
+}
+
+// fire locks if a timeout of the given session has passed, or otherwise sets the timer for the next timeout.
+func (l *autoLock) fire(session uint64) {
+	l.mutex.Lock()
+	if l.session != session {
+		l.mutex.Unlock()
+		return
+	}
+	now := time.Now()
+	var reason LockReason
+	switch {
+	case l.absolute > 0 && !now.Before(l.expires):
+		reason = LockReasonExpired
+	case l.idle > 0 && l.inUse == 0 && !now.Before(l.lastUsed.Add(l.idle)):
+		reason = LockReasonIdle
+	default:
+		// Used since the timer was set, or in use.
+		l.schedule(now)
+		l.mutex.Unlock()
+		return
+	}
+	l.mutex.Unlock()
+	l.lock(session, reason)
+}
@@ -0,0 +1,154 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type autoLocker interface {
+	SetAutoLock(idle time.Duration, absolute time.Duration) error
+}
+
+type walletAutoLocker interface {
+	autoLocker
+	SetAccountsAutoLock(idle time.Duration, absolute time.Duration) error
+	SetLockObserver(observer mpc.LockObserver)
+}
+
+// _autoLockWallet is a helper to create a wallet with a single account, with lock events sent to the returned channel.
+func _autoLockWallet(t *testing.T) (e2wtypes.Wallet, e2wtypes.Account, <-chan *mpc.LockEvent) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), scratch.New(), keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+
+	events := make(chan *mpc.LockEvent, 16)
+	wallet.(walletAutoLocker).SetLockObserver(func(event *mpc.LockEvent) {
+		events <- event
+	})
+	return wallet, account, events
+}
+
+// _nextLockEvent is a helper to wait for the next lock event.
+func _nextLockEvent(t *testing.T, events <-chan *mpc.LockEvent) *mpc.LockEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no lock event")
+		return nil
+	}
+}
+
+func TestAutoLockBadTimeouts(t *testing.T) {
+	wallet, account, _ := _autoLockWallet(t)
+	assert.EqualError(t, wallet.(autoLocker).SetAutoLock(-time.Second, 0), "idle timeout must not be negative")
+	assert.EqualError(t, wallet.(walletAutoLocker).SetAccountsAutoLock(0, -time.Second), "absolute timeout must not be negative")
+	assert.EqualError(t, account.(autoLocker).SetAutoLock(-time.Second, 0), "idle timeout must not be negative")
+}
+
+func TestLockObserver(t *testing.T) {
+	wallet, account, events := _autoLockWallet(t)
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	assert.Equal(t, &mpc.LockEvent{WalletID: wallet.ID(), Unlocked: true}, _nextLockEvent(t, events))
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+	assert.Equal(t, &mpc.LockEvent{WalletID: wallet.ID(), Reason: mpc.LockReasonExplicit}, _nextLockEvent(t, events))
+
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	assert.Equal(t, &mpc.LockEvent{WalletID: wallet.ID(), AccountID: account.ID(), Unlocked: true}, _nextLockEvent(t, events))
+	require.NoError(t, account.(e2wtypes.AccountLocker).Lock(context.Background()))
+	assert.Equal(t, &mpc.LockEvent{WalletID: wallet.ID(), AccountID: account.ID(), Reason: mpc.LockReasonExplicit}, _nextLockEvent(t, events))
+
+	// Locking when locked and failing to unlock are not transitions.
+	require.NoError(t, account.(e2wtypes.AccountLocker).Lock(context.Background()))
+	require.Error(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("wrong passphrase")))
+	assert.Len(t, events, 0)
+}
+
+func TestWalletAutoLock(t *testing.T) {
+	wallet, _, events := _autoLockWallet(t)
+	require.NoError(t, wallet.(autoLocker).SetAutoLock(50*time.Millisecond, 0))
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	assert.True(t, _nextLockEvent(t, events).Unlocked)
+	event := _nextLockEvent(t, events)
+	assert.Equal(t, &mpc.LockEvent{WalletID: wallet.ID(), Reason: mpc.LockReasonIdle}, event)
+	unlocked, err := wallet.(e2wtypes.WalletLocker).IsUnlocked(context.Background())
+	require.NoError(t, err)
+	assert.False(t, unlocked)
+
+	// An explicit lock stops the timeouts.
+	require.NoError(t, wallet.(autoLocker).SetAutoLock(0, 50*time.Millisecond))
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	assert.True(t, _nextLockEvent(t, events).Unlocked)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+	assert.Equal(t, mpc.LockReasonExplicit, _nextLockEvent(t, events).Reason)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, events, 0)
+}
+
+func TestAccountAutoLock(t *testing.T) {
+	wallet, account, events := _autoLockWallet(t)
+	require.NoError(t, account.(autoLocker).SetAutoLock(0, 50*time.Millisecond))
+
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	assert.True(t, _nextLockEvent(t, events).Unlocked)
+	assert.Equal(t, &mpc.LockEvent{WalletID: wallet.ID(), AccountID: account.ID(), Reason: mpc.LockReasonExpired}, _nextLockEvent(t, events))
+	unlocked, err := account.(e2wtypes.AccountLocker).IsUnlocked(context.Background())
+	require.NoError(t, err)
+	assert.False(t, unlocked)
+
+	// The account can be unlocked again.
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	assert.True(t, _nextLockEvent(t, events).Unlocked)
+	assert.Equal(t, mpc.LockReasonExpired, _nextLockEvent(t, events).Reason)
+}
+
+func TestAccountsAutoLock(t *testing.T) {
+	wallet, _, events := _autoLockWallet(t)
+	require.NoError(t, wallet.(walletAutoLocker).SetAccountsAutoLock(50*time.Millisecond, 0))
+
+	account, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Test")
+	require.NoError(t, err)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	assert.True(t, _nextLockEvent(t, events).Unlocked)
+	assert.Equal(t, &mpc.LockEvent{WalletID: wallet.ID(), AccountID: account.ID(), Reason: mpc.LockReasonIdle}, _nextLockEvent(t, events))
+
+	// An account's own timeouts override the wallet's defaults.
+	require.NoError(t, account.(autoLocker).SetAutoLock(0, 0))
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	assert.True(t, _nextLockEvent(t, events).Unlocked)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, events, 0)
+}
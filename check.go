@@ -0,0 +1,400 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	indexer "github.com/wealdtech/go-indexer"
+)
+
+// CheckedAccount is an account reported by Check().
+type CheckedAccount struct {
+	ID   uuid.UUID `json:"uuid"`
+	Name string    `json:"name,omitempty"`
+	Path string    `json:"path,omitempty"`
+	// Error is the reason an account could not be decoded.
+	Error string `json:"error,omitempty"`
+}
+
+// CheckReport is the result of Check().
+type CheckReport struct {
+	// IndexError is the reason the stored index could not be read, if any.
+	IndexError string `json:"index_error,omitempty"`
+	// UndecodableAccounts are the stored accounts that cannot be decoded.  Their IDs are nil if not recoverable.
+	UndecodableAccounts []*CheckedAccount `json:"undecodable_accounts"`
+	// DroppedAccounts are the undecodable accounts left out of the rebuilt index, as their IDs or names could not be
+	// recovered or their names are used by other accounts.  It is only populated when the index is rebuilt.
+	DroppedAccounts []*CheckedAccount `json:"dropped_accounts"`
+	// OrphanedIndexEntries are the entries in the index without a stored account.
+	OrphanedIndexEntries []*CheckedAccount `json:"orphaned_index_entries"`
+	// UnindexedAccounts are the accounts that are missing from the index, or present under a different name or path.
+	UnindexedAccounts []*CheckedAccount `json:"unindexed_accounts"`
+	// DuplicateNames are the accounts that share their name with another account.
+	DuplicateNames []*CheckedAccount `json:"duplicate_names"`
+	// DuplicatePaths are the accounts that share their path with another account.
+	DuplicatePaths []*CheckedAccount `json:"duplicate_paths"`
+	// NextAccount is the wallet's next account number.
+	NextAccount uint64 `json:"next_account"`
+	// MinNextAccount is the lowest next account number that does not clash with the paths of existing accounts.
+	MinNextAccount uint64 `json:"min_next_account"`
+	// Fixed is true if the index and wallet have been rewritten.
+	Fixed bool `json:"fixed"`
+}
+
+// OK returns true if the check found no problems.
+func (r *CheckReport) OK() bool {
+	return r.IndexError == "" &&
+		len(r.UndecodableAccounts) == 0 &&
+		len(r.OrphanedIndexEntries) == 0 &&
+		len(r.UnindexedAccounts) == 0 &&
+		len(r.DuplicateNames) == 0 &&
+		len(r.DuplicatePaths) == 0 &&
+		r.NextAccount >= r.MinNextAccount
+}
+
+// Check checks the consistency of the wallet's index, accounts and next account number.
+// If fix is true the index is rebuilt from the decodable accounts, retaining entries for undecodable accounts, and
+// the next account number is raised if required.  The name, path, public keys and flags of an undecodable account are
+// taken from the stored index, or failing that from what can be read of the account's data; undecodable accounts
+// without an ID or name, or whose name is used by another account, cannot be indexed and are reported as dropped.  The rebuilt index and wallet are written together, with the
+// original index restored if the wallet cannot be written.  Undecodable accounts, and accounts with duplicate names
+// or paths, are reported but not altered; only one of the accounts with a duplicate name can be in the index.
+// The wallet must be unlocked to fix it.
+func (w *wallet) Check(ctx context.Context, fix bool) (*CheckReport, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if fix {
+		if !w.isUnlocked() {
+			return nil, newError(ErrLocked, "wallet must be unlocked to fix it")
+		}
+	}
+
+	report := &CheckReport{
+		UndecodableAccounts:  make([]*CheckedAccount, 0),
+		DroppedAccounts:      make([]*CheckedAccount, 0),
+		OrphanedIndexEntries: make([]*CheckedAccount, 0),
+		UnindexedAccounts:    make([]*CheckedAccount, 0),
+		DuplicateNames:       make([]*CheckedAccount, 0),
+		DuplicatePaths:       make([]*CheckedAccount, 0),
+		NextAccount:          w.nextAccount,
+	}
+
+	storedIndexData, err := w.store.RetrieveAccountsIndex(w.id)
+	storedIndex := indexer.New()
+	storedPaths := newPathIndex()
+	storedPubKeys := newPublicKeyIndex()
+	storedFlags := newFlagIndex()
+	if err != nil {
+		report.IndexError = err.Error()
+		storedIndexData = nil
+	} else if storedIndex, storedPaths, storedPubKeys, storedFlags, _, err = deserializeIndex(storedIndexData); err != nil {
+		report.IndexError = err.Error()
+		storedIndex = indexer.New()
+		storedPaths = newPathIndex()
+		storedPubKeys = newPublicKeyIndex()
+		storedFlags = newFlagIndex()
+	}
+
+	accounts := make([]*account, 0)
+	undecodable := make(map[uuid.UUID]*undecodableAccount)
+	for _, data := range w.retrieveStoredAccounts() {
+		acc, err := deserializeAccount(w, data)
+		if err != nil {
+			checked := &CheckedAccount{
+				ID:    recoverAccountID(data),
+				Error: err.Error(),
+			}
+			details := w.recoverUndecodableAccount(checked.ID, data, storedIndex, storedPaths, storedPubKeys, storedFlags)
+			checked.Name = details.name
+			checked.Path = details.path
+			report.UndecodableAccounts = append(report.UndecodableAccounts, checked)
+			undecodable[checked.ID] = details
+			continue
+		}
+		accounts = append(accounts, acc.(*account))
+	}
+
+	names := make(map[string][]*account)
+	paths := make(map[string][]*account)
+	stored := make(map[uuid.UUID]bool)
+	for _, a := range accounts {
+		stored[a.id] = true
+		names[a.name] = append(names[a.name], a)
+		paths[a.path] = append(paths[a.path], a)
+		name, exists := storedIndex.Name(a.id)
+		// Paths and public keys are not present in indices stored by earlier versions, so are only checked if present.
+		path, pathExists := storedPaths.Path(a.id)
+		keys, keysExist := storedPubKeys.Keys(a.id)
+		if !exists || name != a.name || (pathExists && path != a.path) ||
+			(keysExist && !bytes.Equal(keys.local, a.publicKey.Marshal())) {
+			report.UnindexedAccounts = append(report.UnindexedAccounts, checkedAccount(a))
+		}
+		var accountNum uint64
+		if _, err := fmt.Sscanf(a.path, w.pathTemplate, &accountNum); err == nil &&
+			fmt.Sprintf(w.pathTemplate, accountNum) == a.path &&
+			accountNum >= report.MinNextAccount {
+			report.MinNextAccount = accountNum + 1
+		}
+	}
+	for _, entry := range indexEntries(storedIndex, storedPaths) {
+		if _, isUndecodable := undecodable[entry.ID]; !stored[entry.ID] && !isUndecodable {
+			report.OrphanedIndexEntries = append(report.OrphanedIndexEntries, entry)
+		}
+	}
+	for _, accs := range names {
+		if len(accs) > 1 {
+			for _, a := range accs {
+				report.DuplicateNames = append(report.DuplicateNames, checkedAccount(a))
+			}
+		}
+	}
+	for _, accs := range paths {
+		if len(accs) > 1 {
+			for _, a := range accs {
+				report.DuplicatePaths = append(report.DuplicatePaths, checkedAccount(a))
+			}
+		}
+	}
+	sortCheckedAccounts(report.DuplicateNames)
+	sortCheckedAccounts(report.DuplicatePaths)
+
+	if !fix || report.OK() {
+		return report, nil
+	}
+
+	// Rebuild the index.
+	index := indexer.New()
+	pathIdx := newPathIndex()
+	pubKeyIdx := newPublicKeyIndex()
+	flagIdx := newFlagIndex()
+	for _, checked := range report.UndecodableAccounts {
+		if checked.ID == uuid.Nil || checked.Name == "" || len(names[checked.Name]) > 0 || index.NameKnown(checked.Name) ||
+			index.IDKnown(checked.ID) {
+			report.DroppedAccounts = append(report.DroppedAccounts, checked)
+			continue
+		}
+		index.Add(checked.ID, checked.Name)
+		details := undecodable[checked.ID]
+		// Paths of decodable accounts take precedence.
+		if details.path != "" && len(paths[details.path]) == 0 {
+			if _, exists := pathIdx.ID(details.path); !exists {
+				pathIdx.Add(checked.ID, details.path)
+			}
+		}
+		if details.keys != nil {
+			pubKeyIdx.Add(checked.ID, details.keys)
+		}
+		if details.flags != nil {
+			flagIdx.Add(checked.ID, details.flags)
+		}
+	}
+	sortCheckedAccounts(report.DroppedAccounts)
+	for name, accs := range names {
+		// Prefer the account the stored index already uses for a duplicate name.
+		a := accs[0]
+		if id, exists := storedIndex.ID(name); exists {
+			for _, acc := range accs {
+				if acc.id == id {
+					a = acc
+				}
+			}
+		}
+		index.Add(a.id, a.name)
+	}
+	for _, a := range accounts {
+		pathIdx.Add(a.id, a.path)
+		pubKeyIdx.Add(a.id, a.publicKeys())
+		flagIdx.Add(a.id, a.flags())
+	}
+	nextAccount := w.nextAccount
+	if nextAccount < report.MinNextAccount {
+		nextAccount = report.MinNextAccount
+	}
+
+	if err := w.storeIndexAndWallet(index, pathIdx, pubKeyIdx, flagIdx, nextAccount, storedIndexData); err != nil {
+		return nil, err
+	}
+	report.Fixed = true
+
+	return report, nil
+}
+
+// storeIndexAndWallet stores a new index and next account number for the wallet.
+// If the wallet cannot be stored the previous index data is restored, so that the two remain consistent.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) storeIndexAndWallet(index *indexer.Index, paths *pathIndex, pubKeys *publicKeyIndex, flags *flagIndex, nextAccount uint64, previousIndexData []byte) error {
+	indexData, err := serializeIndex(index, paths, pubKeys, flags)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize index")
+	}
+	previousNextAccount := w.nextAccount
+	w.nextAccount = nextAccount
+	walletData, err := json.Marshal(w)
+	w.nextAccount = previousNextAccount
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize wallet")
+	}
+
+	if err := w.store.StoreAccountsIndex(w.id, indexData); err != nil {
+		return errors.Wrap(err, "failed to store index")
+	}
+	if err := w.store.StoreWallet(w.id, w.name, walletData); err != nil {
+		if previousIndexData != nil {
+			if restoreErr := w.store.StoreAccountsIndex(w.id, previousIndexData); restoreErr != nil {
+				return errors.Wrapf(err, "failed to store wallet, and failed to restore index (%v)", restoreErr)
+			}
+		}
+		return errors.Wrap(err, "failed to store wallet")
+	}
+
+	w.index = index
+	w.paths = paths
+	w.pubKeys = pubKeys
+	w.flags = flags
+	// The stored data is not cached, as the store can retain it.
+	w.indexData = nil
+	w.nextAccount = nextAccount
+	return nil
+}
+
+// checkedAccount returns the report of an account.
+func checkedAccount(a *account) *CheckedAccount {
+	return &CheckedAccount{
+		ID:   a.id,
+		Name: a.name,
+		Path: a.path,
+	}
+}
+
+// undecodableAccount holds the details of an undecodable account that can be recovered.
+type undecodableAccount struct {
+	name  string
+	path  string
+	keys  *accountPublicKeys
+	flags *accountFlags
+}
+
+// recoverUndecodableAccount recovers what it can of the details of an undecodable account, preferring those in the
+// stored index to those in the account's data.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) recoverUndecodableAccount(id uuid.UUID, data []byte, index *indexer.Index, paths *pathIndex, pubKeys *publicKeyIndex, flags *flagIndex) *undecodableAccount {
+	details := &undecodableAccount{}
+	details.name, _ = index.Name(id)
+	details.path, _ = paths.Path(id)
+	details.keys, _ = pubKeys.Keys(id)
+	details.flags, _ = flags.Flags(id)
+
+	// Each field of the data is read separately, as any of them could be the reason that it cannot be decoded.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return details
+	}
+	if details.name == "" {
+		var name string
+		if err := json.Unmarshal(fields["name"], &name); err == nil && checkName("account", name) == nil {
+			details.name = name
+		}
+	}
+	if details.path == "" {
+		var path string
+		if err := json.Unmarshal(fields["path"], &path); err == nil && validatePath(path) == nil {
+			details.path = path
+		}
+	}
+	if details.flags == nil {
+		recordFlags := &accountFlags{}
+		if err := json.Unmarshal(data, recordFlags); err == nil {
+			if _, _, err := recordFlags.links(); err == nil {
+				details.flags = recordFlags
+			}
+		}
+	}
+	if details.keys == nil && details.flags != nil {
+		// The aggregate public key depends on whether the account is local, so requires the flags.
+		var publicKey string
+		if err := json.Unmarshal(fields["pubkey"], &publicKey); err == nil {
+			details.keys = w.recordPublicKeys(publicKey, details.flags.Local)
+		}
+	}
+	return details
+}
+
+// recordPublicKeys returns the public keys of an account given its stored local public key, or nil if it is invalid.
+func (w *wallet) recordPublicKeys(publicKey string, local bool) *accountPublicKeys {
+	data, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return nil
+	}
+	key, err := e2types.BLSPublicKeyFromBytes(data)
+	if err != nil {
+		return nil
+	}
+	a := newAccount()
+	a.publicKey = key
+	a.local = local || w.keyService == nil || w.keyService.publicKey == nil
+	a.keyService = w.keyService
+	return a.publicKeys()
+}
+
+// recoverAccountID attempts to obtain the ID from undecodable account data.
+func recoverAccountID(data []byte) uuid.UUID {
+	var v struct {
+		UUID string `json:"uuid"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return uuid.Nil
+	}
+	if id, err := uuid.Parse(v.UUID); err == nil {
+		return id
+	}
+	if id, err := uuid.Parse(v.ID); err == nil {
+		return id
+	}
+	return uuid.Nil
+}
+
+// indexEntries returns the entries of an index, ordered by name.
+func indexEntries(index *indexer.Index, paths *pathIndex) []*CheckedAccount {
+	entries := make([]*CheckedAccount, 0)
+	data, err := serializeIndex(index, paths, newPublicKeyIndex(), newFlagIndex())
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return entries
+	}
+	sortCheckedAccounts(entries)
+	return entries
+}
+
+// sortCheckedAccounts sorts reported accounts by name and then path, to provide consistent output.
+func sortCheckedAccounts(accounts []*CheckedAccount) {
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Name != accounts[j].Name {
+			return accounts[i].Name < accounts[j].Name
+		}
+		return accounts[i].Path < accounts[j].Path
+	})
+}
@@ -0,0 +1,244 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type walletChecker interface {
+	Check(ctx context.Context, fix bool) (*mpc.CheckReport, error)
+}
+
+func TestCheck(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	accounts := make([]e2wtypes.Account, 2)
+	for i := range accounts {
+		accounts[i], err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("Account %d", i), []byte("account passphrase"))
+		require.NoError(t, err)
+	}
+
+	report, err := wallet.(walletChecker).Check(context.Background(), false)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, uint64(2), report.NextAccount)
+	assert.Equal(t, uint64(2), report.MinNextAccount)
+
+	// An account with a path beyond the next account number.
+	account7, err := wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/7/0", "Account 7", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	// An undecodable account.
+	undecodableID := uuid.New()
+	require.NoError(t, store.StoreAccount(wallet.ID(), undecodableID, []byte(fmt.Sprintf(`{"uuid":"%s","name":5}`, undecodableID))))
+
+	// A copy of the first account, with a different ID.
+	data, err := store.RetrieveAccount(wallet.ID(), accounts[0].ID())
+	require.NoError(t, err)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &record))
+	copyID := uuid.New()
+	record["uuid"] = copyID.String()
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccount(wallet.ID(), copyID, data))
+
+	// An index without the second account, and with an entry for an account that does not exist.
+	orphanID := uuid.New()
+	index := []map[string]string{
+		{"uuid": accounts[0].ID().String(), "name": "Account 0"},
+		{"uuid": account7.ID().String(), "name": "Account 7"},
+		{"uuid": orphanID.String(), "name": "Ghost"},
+	}
+	data, err = json.Marshal(index)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccountsIndex(wallet.ID(), data))
+
+	// A next account number below that of the account paths in use.
+	data, err = store.RetrieveWallet("test wallet")
+	require.NoError(t, err)
+	var walletRecord map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &walletRecord))
+	walletRecord["nextaccount"] = 1
+	data, err = json.Marshal(walletRecord)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreWallet(wallet.ID(), "test wallet", data))
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+
+	report, err = wallet.(walletChecker).Check(context.Background(), false)
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.False(t, report.Fixed)
+	assert.Empty(t, report.IndexError)
+	require.Len(t, report.UndecodableAccounts, 1)
+	assert.Equal(t, undecodableID, report.UndecodableAccounts[0].ID)
+	assert.NotEmpty(t, report.UndecodableAccounts[0].Error)
+	require.Len(t, report.OrphanedIndexEntries, 1)
+	assert.Equal(t, orphanID, report.OrphanedIndexEntries[0].ID)
+	assert.Equal(t, "Ghost", report.OrphanedIndexEntries[0].Name)
+	unindexed := make(map[uuid.UUID]bool)
+	for _, checked := range report.UnindexedAccounts {
+		unindexed[checked.ID] = true
+	}
+	assert.Equal(t, map[uuid.UUID]bool{accounts[1].ID(): true, copyID: true}, unindexed)
+	assert.Len(t, report.DuplicateNames, 2)
+	require.Len(t, report.DuplicatePaths, 2)
+	assert.Equal(t, "m/12381/3600/0/0", report.DuplicatePaths[0].Path)
+	assert.Equal(t, uint64(1), report.NextAccount)
+	assert.Equal(t, uint64(8), report.MinNextAccount)
+
+	_, err = wallet.(walletChecker).Check(context.Background(), true)
+	require.EqualError(t, err, "wallet must be unlocked to fix it")
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	report, err = wallet.(walletChecker).Check(context.Background(), true)
+	require.NoError(t, err)
+	assert.True(t, report.Fixed)
+	// The undecodable account's name cannot be recovered, so it cannot be indexed.
+	require.Len(t, report.DroppedAccounts, 1)
+	assert.Equal(t, undecodableID, report.DroppedAccounts[0].ID)
+
+	// Only the problems that cannot be fixed remain.
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	report, err = wallet.(walletChecker).Check(context.Background(), false)
+	require.NoError(t, err)
+	assert.Len(t, report.UndecodableAccounts, 1)
+	assert.Len(t, report.OrphanedIndexEntries, 0)
+	assert.Len(t, report.UnindexedAccounts, 1)
+	assert.Len(t, report.DuplicateNames, 2)
+	assert.Len(t, report.DuplicatePaths, 2)
+	assert.Equal(t, uint64(8), report.NextAccount)
+
+	account, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 1")
+	require.NoError(t, err)
+	assert.Equal(t, accounts[1].ID(), account.ID())
+	account, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 0")
+	require.NoError(t, err)
+	assert.Equal(t, accounts[0].ID(), account.ID())
+	_, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Ghost")
+	assert.Error(t, err)
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 8", []byte("account passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, "m/12381/3600/8/0", account.(e2wtypes.AccountPathProvider).Path())
+}
+
+func TestCheckUndecodable(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	accounts := make([]e2wtypes.Account, 2)
+	for i := range accounts {
+		accounts[i], err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("Account %d", i), []byte("account passphrase"))
+		require.NoError(t, err)
+	}
+
+	// Make the second account undecodable, and add an undecodable account whose name cannot be recovered.
+	data, err := store.RetrieveAccount(wallet.ID(), accounts[1].ID())
+	require.NoError(t, err)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &record))
+	record["crypto"] = "bad"
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccount(wallet.ID(), accounts[1].ID(), data))
+	namelessID := uuid.New()
+	require.NoError(t, store.StoreAccount(wallet.ID(), namelessID, []byte(fmt.Sprintf(`{"uuid":"%s","name":5}`, namelessID))))
+	storedIndex, err := store.RetrieveAccountsIndex(wallet.ID())
+	require.NoError(t, err)
+
+	checkEntry := func(t *testing.T) {
+		data, err := store.RetrieveAccountsIndex(wallet.ID())
+		require.NoError(t, err)
+		var entries []map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &entries))
+		require.Len(t, entries, 2)
+		for _, entry := range entries {
+			if entry["uuid"] == accounts[1].ID().String() {
+				assert.Equal(t, "Account 1", entry["name"])
+				assert.Equal(t, "m/12381/3600/1/0", entry["path"])
+				assert.Equal(t, fmt.Sprintf("%x", accounts[1].(e2wtypes.AccountPublicKeyProvider).PublicKey().Marshal()), entry["pubkey"])
+				assert.NotNil(t, entry["flags"])
+				return
+			}
+		}
+		assert.Fail(t, "undecodable account not in index")
+	}
+
+	tests := []struct {
+		name  string
+		index []byte
+	}{
+		{
+			name:  "StoredIndex",
+			index: storedIndex,
+		},
+		{
+			name:  "CorruptIndex",
+			index: []byte("bad"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.NoError(t, store.StoreAccountsIndex(wallet.ID(), storedIndex))
+			wallet, err := mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+			require.NoError(t, err)
+			require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+			require.NoError(t, store.StoreAccountsIndex(wallet.ID(), test.index))
+			report, err := wallet.(walletChecker).Check(context.Background(), true)
+			require.NoError(t, err)
+			assert.True(t, report.Fixed)
+
+			// The undecodable account is retained with its path and public keys, and the other is reported as dropped.
+			require.Len(t, report.DroppedAccounts, 1)
+			assert.Equal(t, namelessID, report.DroppedAccounts[0].ID)
+			checkEntry(t)
+		})
+	}
+}
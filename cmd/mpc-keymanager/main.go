@@ -0,0 +1,109 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// mpc-keymanager serves the Ethereum Keymanager API for an MPC wallet.
+//
+// Usage:
+//
+//	mpc-keymanager --base-dir=/path/to/wallets --wallet=name --wallet-passphrase-file=/path/to/passphrase --token-file=/path/to/token [--listen=localhost:7500]
+//
+// If the token file does not exist a new token is generated and written to it.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/keymanager"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+)
+
+// mainnetGenesisValidatorsRoot is the genesis validators root of mainnet.
+const mainnetGenesisValidatorsRoot = "0x4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95"
+
+func main() {
+	baseDir := flag.String("base-dir", "", "base directory of the wallet store")
+	walletName := flag.String("wallet", "", "name of the wallet to manage")
+	walletPassphraseFile := flag.String("wallet-passphrase-file", "", "file containing the wallet passphrase")
+	tokenFile := flag.String("token-file", "", "file containing the API token; generated if it does not exist")
+	genesisValidatorsRootStr := flag.String("genesis-validators-root", mainnetGenesisValidatorsRoot, "genesis validators root for slashing protection exports")
+	listen := flag.String("listen", "localhost:7500", "address on which to listen")
+	flag.Parse()
+
+	if *baseDir == "" || *walletName == "" || *walletPassphraseFile == "" || *tokenFile == "" {
+		log.Fatal("--base-dir, --wallet, --wallet-passphrase-file and --token-file are required")
+	}
+
+	if err := e2types.InitBLS(); err != nil {
+		log.Fatalf("failed to initialise BLS: %v", err)
+	}
+
+	genesisValidatorsRoot, err := hex.DecodeString(strings.TrimPrefix(*genesisValidatorsRootStr, "0x"))
+	if err != nil {
+		log.Fatalf("invalid genesis validators root: %v", err)
+	}
+	walletPassphrase, err := ioutil.ReadFile(*walletPassphraseFile)
+	if err != nil {
+		log.Fatalf("failed to read wallet passphrase: %v", err)
+	}
+	token, err := obtainToken(*tokenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	wallet, err := mpc.OpenWallet(ctx, *walletName, filesystem.New(*baseDir), keystorev4.New())
+	if err != nil {
+		log.Fatalf("failed to open wallet %q: %v", *walletName, err)
+	}
+	service, err := keymanager.New(ctx, wallet, bytes.TrimRight(walletPassphrase, "\r\n"), token, genesisValidatorsRoot)
+	if err != nil {
+		log.Fatalf("failed to create service: %v", err)
+	}
+	log.Printf("serving wallet %q on %s", *walletName, *listen)
+	log.Fatal(http.ListenAndServe(*listen, service))
+}
+
+// obtainToken reads the API token from a file, generating it if the file does not exist.
+func obtainToken(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read token file: %v", err)
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := fmt.Sprintf("api-token-%#x", tokenBytes)
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write token file: %v", err)
+	}
+	log.Printf("generated API token in %s", path)
+	return token, nil
+}
@@ -0,0 +1,433 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// accountInfo is the output for an account.
+type accountInfo struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// PublicKey is the aggregate public key of the account.
+	PublicKey string `json:"pubkey"`
+	Local     bool   `json:"local,omitempty"`
+	Archived  bool   `json:"archived,omitempty"`
+}
+
+// newAccountInfo creates the output for an account.
+func newAccountInfo(account e2wtypes.Account) (*accountInfo, error) {
+	info := &accountInfo{
+		UUID: account.ID().String(),
+		Name: account.Name(),
+	}
+	if pathProvider, isProvider := account.(e2wtypes.AccountPathProvider); isProvider {
+		info.Path = pathProvider.Path()
+	}
+	if localProvider, isProvider := account.(interface{ IsLocal() bool }); isProvider {
+		info.Local = localProvider.IsLocal()
+	}
+	if archivedProvider, isProvider := account.(interface{ IsArchived() bool }); isProvider {
+		info.Archived = archivedProvider.IsArchived()
+	}
+	publicKey := account.(e2wtypes.AccountPublicKeyProvider).PublicKey()
+	if publicKey == nil {
+		return nil, fmt.Errorf("failed to obtain public key for account %q", account.Name())
+	}
+	info.PublicKey = fmt.Sprintf("%#x", publicKey.Marshal())
+	return info, nil
+}
+
+// openAccount opens the named account in the named wallet.
+func (c *cli) openAccount(ctx context.Context, walletName string, accountName string) (e2wtypes.Account, error) {
+	if accountName == "" {
+		return nil, errors.New("--account is required")
+	}
+	wallet, err := c.openWallet(ctx, walletName)
+	if err != nil {
+		return nil, err
+	}
+	return wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(ctx, accountName)
+}
+
+func (c *cli) accountCreate(ctx context.Context, args []string) error {
+	fs := c.flagSet("account create")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	walletPassphraseFile := fs.String("wallet-passphrase-file", "", "file containing the wallet passphrase")
+	name := fs.String("account", "", "name of the account")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the account passphrase")
+	path := fs.String("path", "", "derivation path of the account; the next available path if not supplied")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New("--account is required")
+	}
+
+	wallet, err := c.openWallet(ctx, *walletName)
+	if err != nil {
+		return err
+	}
+	walletPassphrase, err := c.passphrase(*walletPassphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Account passphrase: ")
+	if err != nil {
+		return err
+	}
+	locker := wallet.(e2wtypes.WalletLocker)
+	if err := locker.Unlock(ctx, walletPassphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	var account e2wtypes.Account
+	if *path == "" {
+		account, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(ctx, *name, passphrase)
+	} else {
+		account, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(ctx, *path, *name, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	info, err := newAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	return c.output(info)
+}
+
+func (c *cli) accountList(ctx context.Context, args []string) error {
+	fs := c.flagSet("account list")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	namePrefix := fs.String("name-prefix", "", "only list accounts whose names start with this prefix")
+	path := fs.String("path", "", "only list accounts with this path, or a path below it")
+	offset := fs.Int("offset", 0, "number of accounts to skip")
+	limit := fs.Int("limit", 0, "maximum number of accounts to list (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	wallet, err := c.openWallet(ctx, *walletName)
+	if err != nil {
+		return err
+	}
+	iterator, isIterator := wallet.(interface {
+		IterateAccounts(ctx context.Context, filter *mpc.AccountsFilter) <-chan *mpc.AccountResult
+	})
+	if !isIterator {
+		return errors.New("wallet does not support account iteration")
+	}
+	filter := &mpc.AccountsFilter{
+		NamePrefix: *namePrefix,
+		Path:       *path,
+		Offset:     *offset,
+		Limit:      *limit,
+	}
+
+	// Stop the iterator if an account cannot be listed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	infos := make([]*accountInfo, 0)
+	for res := range iterator.IterateAccounts(ctx, filter) {
+		if res.Err != nil {
+			return errors.Wrapf(res.Err, "failed to obtain account %q", res.Name)
+		}
+		info, err := newAccountInfo(res.Account)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+	}
+	return c.output(infos)
+}
+
+func (c *cli) accountInfo(ctx context.Context, args []string) error {
+	fs := c.flagSet("account info")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	name := fs.String("account", "", "name of the account")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	account, err := c.openAccount(ctx, *walletName, *name)
+	if err != nil {
+		return err
+	}
+	info, err := newAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	return c.output(info)
+}
+
+func (c *cli) accountSign(ctx context.Context, args []string) error {
+	fs := c.flagSet("account sign")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	name := fs.String("account", "", "name of the account")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the account passphrase")
+	dataStr := fs.String("data", "", "data to sign, in hex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dataStr == "" {
+		return errors.New("--data is required")
+	}
+	data, err := decodeHex(*dataStr)
+	if err != nil {
+		return errors.Wrap(err, "invalid data")
+	}
+
+	account, err := c.openAccount(ctx, *walletName, *name)
+	if err != nil {
+		return err
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Account passphrase: ")
+	if err != nil {
+		return err
+	}
+	locker := account.(e2wtypes.AccountLocker)
+	if err := locker.Unlock(ctx, passphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	signature, err := account.(e2wtypes.AccountSigner).Sign(ctx, data)
+	if err != nil {
+		return err
+	}
+	info, err := newAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	return c.output(map[string]string{
+		"pubkey":    info.PublicKey,
+		"signature": fmt.Sprintf("%#x", signature.Marshal()),
+	})
+}
+
+func (c *cli) accountDelete(ctx context.Context, args []string) error {
+	fs := c.flagSet("account delete")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	name := fs.String("account", "", "name of the account")
+	walletPassphraseFile := fs.String("wallet-passphrase-file", "", "file containing the wallet passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	account, err := c.openAccount(ctx, *walletName, *name)
+	if err != nil {
+		return err
+	}
+	wallet := account.(e2wtypes.AccountWalletProvider).Wallet()
+	deleter, isDeleter := wallet.(interface {
+		DeleteAccount(ctx context.Context, id uuid.UUID) error
+	})
+	if !isDeleter {
+		return errors.New("wallet does not support deletion of accounts")
+	}
+	info, err := newAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	walletPassphrase, err := c.passphrase(*walletPassphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	locker := wallet.(e2wtypes.WalletLocker)
+	if err := locker.Unlock(ctx, walletPassphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	if err := deleter.DeleteAccount(ctx, account.ID()); err != nil {
+		return err
+	}
+	return c.output(info)
+}
+
+func (c *cli) accountArchive(ctx context.Context, args []string) error {
+	fs := c.flagSet("account archive")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	name := fs.String("account", "", "name of the account")
+	walletPassphraseFile := fs.String("wallet-passphrase-file", "", "file containing the wallet passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	account, err := c.openAccount(ctx, *walletName, *name)
+	if err != nil {
+		return err
+	}
+	wallet := account.(e2wtypes.AccountWalletProvider).Wallet()
+	archiver, isArchiver := wallet.(interface {
+		ArchiveAccount(ctx context.Context, id uuid.UUID) error
+	})
+	if !isArchiver {
+		return errors.New("wallet does not support archiving accounts")
+	}
+	walletPassphrase, err := c.passphrase(*walletPassphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	locker := wallet.(e2wtypes.WalletLocker)
+	if err := locker.Unlock(ctx, walletPassphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	if err := archiver.ArchiveAccount(ctx, account.ID()); err != nil {
+		return err
+	}
+	account, err = c.openAccount(ctx, *walletName, *name)
+	if err != nil {
+		return err
+	}
+	info, err := newAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	return c.output(info)
+}
+
+func (c *cli) accountRename(ctx context.Context, args []string) error {
+	fs := c.flagSet("account rename")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	name := fs.String("account", "", "name of the account")
+	newName := fs.String("new-name", "", "new name of the account")
+	walletPassphraseFile := fs.String("wallet-passphrase-file", "", "file containing the wallet passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *newName == "" {
+		return errors.New("--new-name is required")
+	}
+
+	account, err := c.openAccount(ctx, *walletName, *name)
+	if err != nil {
+		return err
+	}
+	wallet := account.(e2wtypes.AccountWalletProvider).Wallet()
+	renamer, isRenamer := wallet.(interface {
+		RenameAccount(ctx context.Context, id uuid.UUID, name string) error
+	})
+	if !isRenamer {
+		return errors.New("wallet does not support renaming accounts")
+	}
+	walletPassphrase, err := c.passphrase(*walletPassphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	locker := wallet.(e2wtypes.WalletLocker)
+	if err := locker.Unlock(ctx, walletPassphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	if err := renamer.RenameAccount(ctx, account.ID(), *newName); err != nil {
+		return err
+	}
+	account, err = c.openAccount(ctx, *walletName, *newName)
+	if err != nil {
+		return err
+	}
+	info, err := newAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	return c.output(info)
+}
+
+func (c *cli) accountChangePassphrase(ctx context.Context, args []string) error {
+	fs := c.flagSet("account change-passphrase")
+	walletName := fs.String("wallet", "", "name of the wallet")
+	name := fs.String("account", "", "name of the account")
+	all := fs.Bool("all", false, "change the passphrase of all accounts in the wallet that use the current passphrase")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the current account passphrase")
+	newPassphraseFile := fs.String("new-passphrase-file", "", "file containing the new account passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *all == (*name != "") {
+		return errors.New("one of --account or --all is required")
+	}
+	if *all {
+		return c.accountsChangePassphrase(ctx, *walletName, *passphraseFile, *newPassphraseFile)
+	}
+
+	account, err := c.openAccount(ctx, *walletName, *name)
+	if err != nil {
+		return err
+	}
+	changer, isChanger := account.(interface {
+		ChangePassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) error
+	})
+	if !isChanger {
+		return errors.New("account does not support changing its passphrase")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Account passphrase: ")
+	if err != nil {
+		return err
+	}
+	newPassphrase, err := c.passphrase(*newPassphraseFile, "New account passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	if err := changer.ChangePassphrase(ctx, passphrase, newPassphrase); err != nil {
+		return err
+	}
+	info, err := newAccountInfo(account)
+	if err != nil {
+		return err
+	}
+	return c.output(info)
+}
+
+// accountsChangePassphrase changes the passphrase of all accounts in a wallet that use the current passphrase.
+func (c *cli) accountsChangePassphrase(ctx context.Context, walletName string, passphraseFile string, newPassphraseFile string) error {
+	wallet, err := c.openWallet(ctx, walletName)
+	if err != nil {
+		return err
+	}
+	changer, isChanger := wallet.(interface {
+		ChangeAccountsPassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) (*mpc.PassphraseReport, error)
+	})
+	if !isChanger {
+		return errors.New("wallet does not support changing account passphrases")
+	}
+	passphrase, err := c.passphrase(passphraseFile, "Account passphrase: ")
+	if err != nil {
+		return err
+	}
+	newPassphrase, err := c.passphrase(newPassphraseFile, "New account passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	report, err := changer.ChangeAccountsPassphrase(ctx, passphrase, newPassphrase)
+	if err != nil {
+		return err
+	}
+	return c.output(report)
+}
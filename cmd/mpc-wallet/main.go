@@ -0,0 +1,170 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// mpc-wallet manages MPC wallets and their accounts.
+//
+// Usage:
+//
+//	mpc-wallet [--store=filesystem|scratch] [--base-dir=/path/to/wallets] <wallet|account> <command> [flags]
+//
+// Passphrases are read from the files supplied in the passphrase flags, or prompted for if no file is supplied.
+// All output is JSON.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/pkg/errors"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// cli holds the state of the command-line tool.
+type cli struct {
+	store     e2wtypes.Store
+	encryptor e2wtypes.Encryptor
+	out       io.Writer
+	errOut    io.Writer
+	// prompt obtains a passphrase interactively.
+	prompt func(prompt string) ([]byte, error)
+}
+
+// command is a command of the tool.
+type command func(ctx context.Context, args []string) error
+
+func main() {
+	storeType := flag.String("store", "filesystem", "type of store (filesystem or scratch)")
+	baseDir := flag.String("base-dir", "", "base directory of the filesystem store")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: mpc-wallet [flags] <wallet|account> <command> [flags]\n\nCommands:\n")
+		fmt.Fprintf(os.Stderr, "  wallet change-passphrase|check|create|info|recover|rename|set-key-service|verify|export|import\n")
+		fmt.Fprintf(os.Stderr, "  account create|list|info|sign|delete|archive|rename|change-passphrase\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var store e2wtypes.Store
+	switch *storeType {
+	case "filesystem":
+		if *baseDir == "" {
+			fmt.Fprintln(os.Stderr, "--base-dir is required for the filesystem store")
+			os.Exit(1)
+		}
+		store = filesystem.New(*baseDir)
+	case "scratch":
+		store = scratch.New()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown store %q\n", *storeType)
+		os.Exit(1)
+	}
+
+	if err := e2types.InitBLS(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialise BLS: %v\n", err)
+		os.Exit(1)
+	}
+
+	c := &cli{
+		store:     store,
+		encryptor: keystorev4.New(),
+		out:       os.Stdout,
+		errOut:    os.Stderr,
+		prompt:    promptTerminal,
+	}
+	if err := c.run(context.Background(), flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command given by the arguments.
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("command required")
+	}
+	commands := map[string]command{
+		"wallet change-passphrase":  c.walletChangePassphrase,
+		"wallet check":              c.walletCheck,
+		"wallet create":             c.walletCreate,
+		"wallet info":               c.walletInfo,
+		"wallet recover":            c.walletRecover,
+		"wallet rename":             c.walletRename,
+		"wallet set-key-service":    c.walletSetKeyService,
+		"wallet verify":             c.walletVerify,
+		"wallet export":             c.walletExport,
+		"wallet import":             c.walletImport,
+		"account create":            c.accountCreate,
+		"account list":              c.accountList,
+		"account info":              c.accountInfo,
+		"account sign":              c.accountSign,
+		"account delete":            c.accountDelete,
+		"account archive":           c.accountArchive,
+		"account rename":            c.accountRename,
+		"account change-passphrase": c.accountChangePassphrase,
+	}
+	name := args[0] + " " + args[1]
+	cmd, exists := commands[name]
+	if !exists {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd(ctx, args[2:])
+}
+
+// flagSet creates a flag set for a command.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.errOut)
+	return fs
+}
+
+// passphrase obtains a passphrase from a file, or by prompting if the file is not supplied.
+func (c *cli) passphrase(path string, prompt string) ([]byte, error) {
+	if path == "" {
+		return c.prompt(prompt)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read passphrase file %s", path)
+	}
+	return bytes.TrimRight(data, "\r\n"), nil
+}
+
+// output writes a JSON result.
+func (c *cli) output(v interface{}) error {
+	return json.NewEncoder(c.out).Encode(v)
+}
+
+// promptTerminal prompts for a passphrase on the terminal, without echoing it.
+func promptTerminal(prompt string) ([]byte, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("no passphrase file supplied and not running in a terminal (%s)", strings.TrimSuffix(prompt, ": "))
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read passphrase")
+	}
+	return passphrase, nil
+}
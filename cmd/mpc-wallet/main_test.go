@@ -0,0 +1,382 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+func TestMain(m *testing.M) {
+	if err := e2types.InitBLS(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// _cli is a helper to create a command-line tool with a scratch store, answering prompts from the supplied map.
+func _cli(passphrases map[string]string) (*cli, *bytes.Buffer) {
+	out := new(bytes.Buffer)
+	return &cli{
+		store:     scratch.New(),
+		encryptor: keystorev4.New(),
+		out:       out,
+		errOut:    ioutil.Discard,
+		prompt: func(prompt string) ([]byte, error) {
+			passphrase, exists := passphrases[prompt]
+			if !exists {
+				return nil, fmt.Errorf("unexpected prompt %q", prompt)
+			}
+			return []byte(passphrase), nil
+		},
+	}, out
+}
+
+// _run is a helper to run a command, returning its decoded output.
+func _run(t *testing.T, c *cli, out *bytes.Buffer, args ...string) interface{} {
+	out.Reset()
+	require.NoError(t, c.run(context.Background(), args))
+	var res interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &res), out.String())
+	return res
+}
+
+func TestCLI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCLI")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var request struct {
+			Payload string `json:"payload"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		payload, err := hex.DecodeString(request.Payload)
+		require.NoError(t, err)
+		rw.Write([]byte(fmt.Sprintf(`{"sign":"%x"}`, remoteKey.Sign(payload).Marshal())))
+	}))
+	defer keyService.Close()
+
+	seedFile := filepath.Join(dir, "seed")
+	require.NoError(t, ioutil.WriteFile(seedFile, []byte("0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f\n"), 0600))
+	accountPassphraseFile := filepath.Join(dir, "account-passphrase")
+	require.NoError(t, ioutil.WriteFile(accountPassphraseFile, []byte("account passphrase\n"), 0600))
+
+	c, out := _cli(map[string]string{
+		"Wallet passphrase: ": "wallet passphrase",
+		"Export passphrase: ": "export passphrase",
+	})
+
+	err = c.run(context.Background(), []string{"wallet", "unknown"})
+	assert.EqualError(t, err, `unknown command "wallet unknown"`)
+
+	res := _run(t, c, out, "wallet", "create", "--wallet=Test", "--key-service-url="+keyService.URL, fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()), "--seed-file="+seedFile)
+	assert.Equal(t, "Test", res.(map[string]interface{})["name"])
+	assert.Equal(t, "multi-party", res.(map[string]interface{})["type"])
+	assert.Equal(t, keyService.URL, res.(map[string]interface{})["key_service_url"])
+
+	res = _run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 1", "--passphrase-file="+accountPassphraseFile)
+	assert.Equal(t, "m/12381/3600/0/0", res.(map[string]interface{})["path"])
+	pubkey := res.(map[string]interface{})["pubkey"].(string)
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 2", "--passphrase-file="+accountPassphraseFile, "--path=m/12381/3600/5/0")
+
+	res = _run(t, c, out, "account", "list", "--wallet=Test")
+	require.Len(t, res, 2)
+	assert.Equal(t, "Account 1", res.([]interface{})[0].(map[string]interface{})["name"])
+	assert.Equal(t, "m/12381/3600/5/0", res.([]interface{})[1].(map[string]interface{})["path"])
+	res = _run(t, c, out, "account", "list", "--wallet=Test", "--path=m/12381/3600/5")
+	require.Len(t, res, 1)
+	assert.Equal(t, "Account 2", res.([]interface{})[0].(map[string]interface{})["name"])
+	res = _run(t, c, out, "account", "list", "--wallet=Test", "--offset=1", "--limit=1")
+	require.Len(t, res, 1)
+	assert.Equal(t, "Account 2", res.([]interface{})[0].(map[string]interface{})["name"])
+
+	res = _run(t, c, out, "account", "info", "--wallet=Test", "--account=Account 1")
+	assert.Equal(t, pubkey, res.(map[string]interface{})["pubkey"])
+
+	err = c.run(context.Background(), []string{"account", "sign", "--wallet=Test", "--account=Account 1", "--passphrase-file=" + accountPassphraseFile})
+	assert.EqualError(t, err, "--data is required")
+	res = _run(t, c, out, "account", "sign", "--wallet=Test", "--account=Account 1", "--passphrase-file="+accountPassphraseFile, "--data=0x0102")
+	signatureBytes, err := hex.DecodeString(strings.TrimPrefix(res.(map[string]interface{})["signature"].(string), "0x"))
+	require.NoError(t, err)
+	signature, err := e2types.BLSSignatureFromBytes(signatureBytes)
+	require.NoError(t, err)
+	publicKeyBytes, err := hex.DecodeString(strings.TrimPrefix(pubkey, "0x"))
+	require.NoError(t, err)
+	publicKey, err := e2types.BLSPublicKeyFromBytes(publicKeyBytes)
+	require.NoError(t, err)
+	assert.True(t, signature.Verify([]byte{0x01, 0x02}, publicKey))
+
+	res = _run(t, c, out, "wallet", "set-key-service", "--wallet=Test", "--key-service-url=http://localhost:9000")
+	assert.Equal(t, "http://localhost:9000", res.(map[string]interface{})["key_service_url"])
+
+	res = _run(t, c, out, "wallet", "export", "--wallet=Test")
+	exported := res.(map[string]interface{})["data"].(string)
+
+	c2, out2 := _cli(map[string]string{
+		"Export passphrase: ": "export passphrase",
+	})
+	res = _run(t, c2, out2, "wallet", "import", "--data="+exported)
+	assert.Equal(t, "Test", res.(map[string]interface{})["name"])
+	res = _run(t, c2, out2, "account", "list", "--wallet=Test")
+	require.Len(t, res, 2)
+	assert.Equal(t, pubkey, res.([]interface{})[0].(map[string]interface{})["pubkey"])
+}
+
+func TestCLIMnemonic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCLIMnemonic")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	accountPassphraseFile := filepath.Join(dir, "account-passphrase")
+	require.NoError(t, ioutil.WriteFile(accountPassphraseFile, []byte("account passphrase\n"), 0600))
+
+	c, out := _cli(map[string]string{
+		"Wallet passphrase: ":      "wallet passphrase",
+		"New wallet passphrase: ":  "new passphrase",
+		"New account passphrase: ": "new account passphrase",
+	})
+
+	res := _run(t, c, out, "wallet", "create", "--wallet=Test", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()))
+	mnemonic := res.(map[string]interface{})["mnemonic"].(string)
+	assert.Len(t, strings.Fields(mnemonic), 24)
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 1", "--passphrase-file="+accountPassphraseFile)
+
+	res = _run(t, c, out, "wallet", "info", "--wallet=Test")
+	assert.Nil(t, res.(map[string]interface{})["mnemonic"])
+
+	err = c.run(context.Background(), []string{"wallet", "recover", "--wallet=Test"})
+	assert.EqualError(t, err, "--wallet and --mnemonic-file are required")
+
+	mnemonicFile := filepath.Join(dir, "mnemonic")
+	require.NoError(t, ioutil.WriteFile(mnemonicFile, []byte(mnemonic+"\n"), 0600))
+
+	// A wallet without accounts cannot be checked against the mnemonic, so is only recovered if explicitly allowed.
+	_run(t, c, out, "wallet", "create", "--wallet=Empty", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()))
+	err = c.run(context.Background(), []string{"wallet", "recover", "--wallet=Empty", "--mnemonic-file=" + mnemonicFile})
+	assert.EqualError(t, err, `wallet "Empty" has no accounts against which to verify the mnemonic`)
+	_run(t, c, out, "wallet", "recover", "--wallet=Empty", "--mnemonic-file="+mnemonicFile, "--allow-unverified")
+
+	res = _run(t, c, out, "wallet", "recover", "--wallet=Test", "--mnemonic-file="+mnemonicFile)
+	assert.Equal(t, "Test", res.(map[string]interface{})["name"])
+
+	// The wallet now requires the new passphrase to create accounts.
+	newPassphraseFile := filepath.Join(dir, "new-passphrase")
+	require.NoError(t, ioutil.WriteFile(newPassphraseFile, []byte("new passphrase\n"), 0600))
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 2", "--passphrase-file="+accountPassphraseFile, "--wallet-passphrase-file="+newPassphraseFile)
+}
+
+func TestCLIVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCLIVerify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	accountPassphraseFile := filepath.Join(dir, "account-passphrase")
+	require.NoError(t, ioutil.WriteFile(accountPassphraseFile, []byte("account passphrase\n"), 0600))
+
+	c, out := _cli(map[string]string{
+		"Wallet passphrase: ":  "wallet passphrase",
+		"Account passphrase: ": "account passphrase",
+	})
+
+	_run(t, c, out, "wallet", "create", "--wallet=Test", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()))
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 1", "--passphrase-file="+accountPassphraseFile)
+
+	res := _run(t, c, out, "wallet", "verify", "--wallet=Test")
+	require.Len(t, res.(map[string]interface{})["verified"], 1)
+	assert.Equal(t, "Account 1", res.(map[string]interface{})["verified"].([]interface{})[0].(map[string]interface{})["name"])
+	assert.Len(t, res.(map[string]interface{})["mismatched"], 0)
+	assert.Len(t, res.(map[string]interface{})["missing"], 0)
+
+	res = _run(t, c, out, "wallet", "verify", "--wallet=Test", "--repair")
+	assert.Len(t, res.(map[string]interface{})["recreated"], 0)
+}
+
+func TestCLIDerivationPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCLIDerivationPath")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	accountPassphraseFile := filepath.Join(dir, "account-passphrase")
+	require.NoError(t, ioutil.WriteFile(accountPassphraseFile, []byte("account passphrase\n"), 0600))
+
+	c, out := _cli(map[string]string{
+		"Wallet passphrase: ": "wallet passphrase",
+	})
+
+	err = c.run(context.Background(), []string{"wallet", "create", "--wallet=Bad", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()), "--derivation-path=m/12381/3600"})
+	assert.EqualError(t, err, `invalid option WithDerivationPath: path template "m/12381/3600" must contain a single %d`)
+
+	_run(t, c, out, "wallet", "create", "--wallet=Withdrawal", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()), "--derivation-path=withdrawal")
+	res := _run(t, c, out, "account", "create", "--wallet=Withdrawal", "--account=Account 1", "--passphrase-file="+accountPassphraseFile)
+	assert.Equal(t, "m/12381/3600/0", res.(map[string]interface{})["path"])
+
+	_run(t, c, out, "wallet", "create", "--wallet=Custom", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()), "--derivation-path=m/12381/3600/7/%d")
+	res = _run(t, c, out, "account", "create", "--wallet=Custom", "--account=Account 1", "--passphrase-file="+accountPassphraseFile)
+	assert.Equal(t, "m/12381/3600/7/0", res.(map[string]interface{})["path"])
+}
+
+func TestCLICheck(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+
+	c, out := _cli(map[string]string{
+		"Wallet passphrase: ": "wallet passphrase",
+	})
+
+	res := _run(t, c, out, "wallet", "create", "--wallet=Test", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()))
+	walletID, err := uuid.Parse(res.(map[string]interface{})["uuid"].(string))
+	require.NoError(t, err)
+
+	res = _run(t, c, out, "wallet", "check", "--wallet=Test")
+	assert.Equal(t, false, res.(map[string]interface{})["fixed"])
+	assert.Len(t, res.(map[string]interface{})["orphaned_index_entries"], 0)
+
+	// Add an index entry without an account.
+	require.NoError(t, c.store.StoreAccountsIndex(walletID, []byte(fmt.Sprintf(`[{"uuid":"%s","name":"Ghost"}]`, uuid.New()))))
+	out.Reset()
+	err = c.run(context.Background(), []string{"wallet", "check", "--wallet=Test"})
+	assert.EqualError(t, err, "wallet check found problems")
+
+	res = _run(t, c, out, "wallet", "check", "--wallet=Test", "--fix")
+	assert.Equal(t, true, res.(map[string]interface{})["fixed"])
+	assert.Len(t, res.(map[string]interface{})["orphaned_index_entries"], 1)
+
+	res = _run(t, c, out, "wallet", "check", "--wallet=Test")
+	assert.Len(t, res.(map[string]interface{})["orphaned_index_entries"], 0)
+}
+
+func TestCLIDeleteArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCLIDeleteArchive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+
+	accountPassphraseFile := filepath.Join(dir, "account-passphrase")
+	require.NoError(t, ioutil.WriteFile(accountPassphraseFile, []byte("account passphrase\n"), 0600))
+
+	c, out := _cli(map[string]string{
+		"Wallet passphrase: ": "wallet passphrase",
+	})
+	c.store = filesystem.New(filepath.Join(dir, "wallets"))
+
+	_run(t, c, out, "wallet", "create", "--wallet=Test", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()))
+	for _, name := range []string{"Account 1", "Account 2", "Account 3"} {
+		_run(t, c, out, "account", "create", "--wallet=Test", "--account="+name, "--passphrase-file="+accountPassphraseFile)
+	}
+
+	res := _run(t, c, out, "account", "archive", "--wallet=Test", "--account=Account 1")
+	assert.Equal(t, true, res.(map[string]interface{})["archived"])
+	err = c.run(context.Background(), []string{"account", "sign", "--wallet=Test", "--account=Account 1", "--passphrase-file=" + accountPassphraseFile, "--data=0x0102"})
+	assert.EqualError(t, err, "account is archived")
+
+	res = _run(t, c, out, "account", "delete", "--wallet=Test", "--account=Account 2")
+	assert.Equal(t, "Account 2", res.(map[string]interface{})["name"])
+
+	res = _run(t, c, out, "account", "list", "--wallet=Test")
+	require.Len(t, res, 2)
+	assert.Equal(t, "Account 1", res.([]interface{})[0].(map[string]interface{})["name"])
+	assert.Equal(t, "Account 3", res.([]interface{})[1].(map[string]interface{})["name"])
+}
+
+func TestCLIRename(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+
+	c, out := _cli(map[string]string{
+		"Wallet passphrase: ":  "wallet passphrase",
+		"Account passphrase: ": "account passphrase",
+	})
+
+	_run(t, c, out, "wallet", "create", "--wallet=Test", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()))
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 1")
+
+	res := _run(t, c, out, "wallet", "rename", "--wallet=Test", "--new-name=Renamed")
+	assert.Equal(t, "Renamed", res.(map[string]interface{})["name"])
+	res = _run(t, c, out, "account", "rename", "--wallet=Renamed", "--account=Account 1", "--new-name=Validator 1")
+	assert.Equal(t, "Validator 1", res.(map[string]interface{})["name"])
+
+	err = c.run(context.Background(), []string{"account", "rename", "--wallet=Renamed", "--account=Validator 1", "--new-name=_hidden"})
+	assert.EqualError(t, err, `invalid account name "_hidden"`)
+
+	res = _run(t, c, out, "account", "list", "--wallet=Renamed")
+	require.Len(t, res, 1)
+	assert.Equal(t, "Validator 1", res.([]interface{})[0].(map[string]interface{})["name"])
+}
+
+func TestCLIChangePassphrase(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+
+	passphrases := map[string]string{
+		"Wallet passphrase: ":      "wallet passphrase",
+		"New wallet passphrase: ":  "new wallet passphrase",
+		"Account passphrase: ":     "account passphrase",
+		"New account passphrase: ": "new account passphrase",
+	}
+	c, out := _cli(passphrases)
+
+	_run(t, c, out, "wallet", "create", "--wallet=Test", "--key-service-url=http://localhost:8000", fmt.Sprintf("--key-service-pubkey=%#x", remoteKey.PublicKey().Marshal()))
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 1")
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 2")
+
+	_run(t, c, out, "wallet", "change-passphrase", "--wallet=Test")
+	passphrases["Wallet passphrase: "] = "new wallet passphrase"
+	_run(t, c, out, "account", "create", "--wallet=Test", "--account=Account 3")
+
+	err = c.run(context.Background(), []string{"account", "change-passphrase", "--wallet=Test"})
+	assert.EqualError(t, err, "one of --account or --all is required")
+
+	res := _run(t, c, out, "account", "change-passphrase", "--wallet=Test", "--account=Account 1")
+	assert.Equal(t, "Account 1", res.(map[string]interface{})["name"])
+
+	res = _run(t, c, out, "account", "change-passphrase", "--wallet=Test", "--all")
+	assert.Equal(t, []interface{}{"Account 2", "Account 3"}, res.(map[string]interface{})["changed"])
+	assert.Equal(t, map[string]interface{}{"Account 1": "incorrect passphrase"}, res.(map[string]interface{})["skipped"])
+
+	for _, name := range []string{"Account 1", "Account 2", "Account 3"} {
+		account, err := c.openAccount(context.Background(), "Test", name)
+		require.NoError(t, err)
+		require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("new account passphrase")))
+	}
+}
@@ -0,0 +1,464 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/pkg/errors"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// walletInfo is the output for a wallet.
+type walletInfo struct {
+	UUID          string `json:"uuid"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Version       uint   `json:"version"`
+	KeyServiceURL string `json:"key_service_url"`
+	// Mnemonic is only output when a wallet is created with a generated mnemonic.
+	Mnemonic string `json:"mnemonic,omitempty"`
+}
+
+// keyServiceURLProvider is the interface for wallets that provide their key service URL.
+type keyServiceURLProvider interface {
+	KeyServiceURL() string
+}
+
+// newWalletInfo creates the output for a wallet.
+func newWalletInfo(wallet e2wtypes.Wallet) *walletInfo {
+	info := &walletInfo{
+		UUID:    wallet.ID().String(),
+		Name:    wallet.Name(),
+		Type:    wallet.Type(),
+		Version: wallet.Version(),
+	}
+	if provider, isProvider := wallet.(keyServiceURLProvider); isProvider {
+		info.KeyServiceURL = provider.KeyServiceURL()
+	}
+	return info
+}
+
+// openWallet opens the named wallet.
+func (c *cli) openWallet(ctx context.Context, name string) (e2wtypes.Wallet, error) {
+	if name == "" {
+		return nil, errors.New("--wallet is required")
+	}
+	return mpc.OpenWallet(ctx, name, c.store, c.encryptor)
+}
+
+// decodeHex decodes a hex string, with or without a 0x prefix.
+func decodeHex(input string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(input), "0x"))
+}
+
+func (c *cli) walletCreate(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet create")
+	name := fs.String("wallet", "", "name of the wallet")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the wallet passphrase")
+	keyServiceURL := fs.String("key-service-url", "", "URL of the key service")
+	keyServicePubKey := fs.String("key-service-pubkey", "", "public key of the key service's share, in hex")
+	seedFile := fs.String("seed-file", "", "file containing a 64-byte hex seed; a mnemonic is generated if not supplied")
+	mnemonicPassphraseFile := fs.String("mnemonic-passphrase-file", "", "file containing the optional passphrase for a generated mnemonic")
+	derivationPath := fs.String("derivation-path", "signing", `template for the paths of new accounts: "signing", "withdrawal" or a path containing %d`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *keyServiceURL == "" || *keyServicePubKey == "" {
+		return errors.New("--wallet, --key-service-url and --key-service-pubkey are required")
+	}
+	pathTemplate := *derivationPath
+	switch pathTemplate {
+	case "signing":
+		pathTemplate = mpc.SigningPathTemplate
+	case "withdrawal":
+		pathTemplate = mpc.WithdrawalPathTemplate
+	}
+
+	pubKey, err := decodeHex(*keyServicePubKey)
+	if err != nil {
+		return errors.Wrap(err, "invalid key service public key")
+	}
+	var seed []byte
+	if *seedFile != "" {
+		data, err := ioutil.ReadFile(*seedFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read seed file")
+		}
+		if seed, err = decodeHex(string(data)); err != nil {
+			return errors.Wrap(err, "invalid seed")
+		}
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	opts := []mpc.Option{
+		mpc.WithKeyService(*keyServiceURL, pubKey),
+		mpc.WithDerivationPath(pathTemplate),
+	}
+	if seed != nil {
+		wallet, err := mpc.CreateWalletWithOptions(ctx, *name, passphrase, c.store, c.encryptor, append(opts, mpc.WithSeed(seed))...)
+		if err != nil {
+			return err
+		}
+		return c.output(newWalletInfo(wallet))
+	}
+
+	mnemonicPassphrase, err := optionalFile(*mnemonicPassphraseFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read mnemonic passphrase file")
+	}
+	wallet, mnemonic, err := mpc.CreateWalletWithMnemonic(ctx, *name, passphrase, c.store, c.encryptor, mnemonicPassphrase, opts...)
+	if err != nil {
+		return err
+	}
+	info := newWalletInfo(wallet)
+	info.Mnemonic = mnemonic
+	return c.output(info)
+}
+
+func (c *cli) walletRecover(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet recover")
+	name := fs.String("wallet", "", "name of the wallet")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the new wallet passphrase")
+	accountPassphraseFile := fs.String("account-passphrase-file", "", "file containing the new passphrase for the wallet's accounts")
+	mnemonicFile := fs.String("mnemonic-file", "", "file containing the wallet's mnemonic")
+	mnemonicPassphraseFile := fs.String("mnemonic-passphrase-file", "", "file containing the optional passphrase for the mnemonic")
+	allowUnverified := fs.Bool("allow-unverified", false, "recover the wallet even if it has no accounts against which to check the mnemonic")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *mnemonicFile == "" {
+		return errors.New("--wallet and --mnemonic-file are required")
+	}
+
+	mnemonic, err := optionalFile(*mnemonicFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read mnemonic file")
+	}
+	mnemonicPassphrase, err := optionalFile(*mnemonicPassphraseFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read mnemonic passphrase file")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "New wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	accountPassphrase, err := c.passphrase(*accountPassphraseFile, "New account passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	opts := make([]mpc.Option, 0)
+	if *allowUnverified {
+		opts = append(opts, mpc.WithUnverifiedRecovery())
+	}
+	wallet, err := mpc.RecoverWallet(ctx, *name, passphrase, accountPassphrase, c.store, c.encryptor, strings.TrimSpace(mnemonic), mnemonicPassphrase, opts...)
+	if err != nil {
+		return err
+	}
+	return c.output(newWalletInfo(wallet))
+}
+
+// optionalFile returns the contents of a file without trailing newlines, or an empty string if no file is supplied.
+func optionalFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func (c *cli) walletInfo(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet info")
+	name := fs.String("wallet", "", "name of the wallet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	wallet, err := c.openWallet(ctx, *name)
+	if err != nil {
+		return err
+	}
+	return c.output(newWalletInfo(wallet))
+}
+
+func (c *cli) walletSetKeyService(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet set-key-service")
+	name := fs.String("wallet", "", "name of the wallet")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the wallet passphrase")
+	keyServiceURL := fs.String("key-service-url", "", "new URL of the key service")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keyServiceURL == "" {
+		return errors.New("--key-service-url is required")
+	}
+
+	wallet, err := c.openWallet(ctx, *name)
+	if err != nil {
+		return err
+	}
+	setter, isSetter := wallet.(interface {
+		SetKeyServiceURL(ctx context.Context, keyServiceURL string) error
+	})
+	if !isSetter {
+		return errors.New("wallet does not support setting the key service")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	locker := wallet.(e2wtypes.WalletLocker)
+	if err := locker.Unlock(ctx, passphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	if err := setter.SetKeyServiceURL(ctx, *keyServiceURL); err != nil {
+		return err
+	}
+	return c.output(newWalletInfo(wallet))
+}
+
+func (c *cli) walletRename(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet rename")
+	name := fs.String("wallet", "", "name of the wallet")
+	newName := fs.String("new-name", "", "new name of the wallet")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the wallet passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *newName == "" {
+		return errors.New("--new-name is required")
+	}
+
+	wallet, err := c.openWallet(ctx, *name)
+	if err != nil {
+		return err
+	}
+	renamer, isRenamer := wallet.(interface {
+		RenameWallet(ctx context.Context, name string) error
+	})
+	if !isRenamer {
+		return errors.New("wallet does not support renaming")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	locker := wallet.(e2wtypes.WalletLocker)
+	if err := locker.Unlock(ctx, passphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	if err := renamer.RenameWallet(ctx, *newName); err != nil {
+		return err
+	}
+	return c.output(newWalletInfo(wallet))
+}
+
+func (c *cli) walletChangePassphrase(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet change-passphrase")
+	name := fs.String("wallet", "", "name of the wallet")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the current wallet passphrase")
+	newPassphraseFile := fs.String("new-passphrase-file", "", "file containing the new wallet passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	wallet, err := c.openWallet(ctx, *name)
+	if err != nil {
+		return err
+	}
+	changer, isChanger := wallet.(interface {
+		ChangePassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) error
+	})
+	if !isChanger {
+		return errors.New("wallet does not support changing its passphrase")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	newPassphrase, err := c.passphrase(*newPassphraseFile, "New wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	if err := changer.ChangePassphrase(ctx, passphrase, newPassphrase); err != nil {
+		return err
+	}
+	return c.output(newWalletInfo(wallet))
+}
+
+func (c *cli) walletExport(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet export")
+	name := fs.String("wallet", "", "name of the wallet")
+	passphraseFile := fs.String("export-passphrase-file", "", "file containing the passphrase to protect the export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	wallet, err := c.openWallet(ctx, *name)
+	if err != nil {
+		return err
+	}
+	exporter, isExporter := wallet.(e2wtypes.WalletExporter)
+	if !isExporter {
+		return errors.New("wallet does not support export")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Export passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	data, err := exporter.Export(ctx, passphrase)
+	if err != nil {
+		return err
+	}
+	return c.output(map[string]string{"data": fmt.Sprintf("%#x", data)})
+}
+
+func (c *cli) walletImport(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet import")
+	dataStr := fs.String("data", "", "exported wallet, in hex")
+	dataFile := fs.String("data-file", "", "file containing the exported wallet, in hex")
+	passphraseFile := fs.String("export-passphrase-file", "", "file containing the passphrase protecting the export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dataFile != "" {
+		data, err := ioutil.ReadFile(*dataFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read data file")
+		}
+		*dataStr = string(data)
+	}
+	if *dataStr == "" {
+		return errors.New("--data or --data-file is required")
+	}
+	data, err := decodeHex(*dataStr)
+	if err != nil {
+		return errors.Wrap(err, "invalid data")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Export passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	wallet, err := mpc.Import(ctx, data, passphrase, c.store, c.encryptor)
+	if err != nil {
+		return err
+	}
+	return c.output(newWalletInfo(wallet))
+}
+
+func (c *cli) walletVerify(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet verify")
+	name := fs.String("wallet", "", "name of the wallet")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the wallet passphrase")
+	repair := fs.Bool("repair", false, "recreate missing accounts")
+	accountPassphraseFile := fs.String("account-passphrase-file", "", "file containing the passphrase for recreated accounts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	wallet, err := c.openWallet(ctx, *name)
+	if err != nil {
+		return err
+	}
+	verifier, isVerifier := wallet.(interface {
+		VerifyAndRepair(ctx context.Context, passphrase []byte) (*mpc.VerifyReport, error)
+	})
+	if !isVerifier {
+		return errors.New("wallet does not support verification")
+	}
+	passphrase, err := c.passphrase(*passphraseFile, "Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+	var accountPassphrase []byte
+	if *repair {
+		if accountPassphrase, err = c.passphrase(*accountPassphraseFile, "Account passphrase: "); err != nil {
+			return err
+		}
+	}
+	locker := wallet.(e2wtypes.WalletLocker)
+	if err := locker.Unlock(ctx, passphrase); err != nil {
+		return err
+	}
+	defer locker.Lock(ctx)
+
+	report, err := verifier.VerifyAndRepair(ctx, accountPassphrase)
+	if err != nil {
+		return err
+	}
+	return c.output(report)
+}
+
+func (c *cli) walletCheck(ctx context.Context, args []string) error {
+	fs := c.flagSet("wallet check")
+	name := fs.String("wallet", "", "name of the wallet")
+	fix := fs.Bool("fix", false, "rewrite the index and wallet to fix the problems found")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the wallet passphrase, required with --fix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	wallet, err := c.openWallet(ctx, *name)
+	if err != nil {
+		return err
+	}
+	checker, isChecker := wallet.(interface {
+		Check(ctx context.Context, fix bool) (*mpc.CheckReport, error)
+	})
+	if !isChecker {
+		return errors.New("wallet does not support checks")
+	}
+	if *fix {
+		passphrase, err := c.passphrase(*passphraseFile, "Wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		locker := wallet.(e2wtypes.WalletLocker)
+		if err := locker.Unlock(ctx, passphrase); err != nil {
+			return err
+		}
+		defer locker.Lock(ctx)
+	}
+
+	report, err := checker.Check(ctx, *fix)
+	if err != nil {
+		return err
+	}
+	if err := c.output(report); err != nil {
+		return err
+	}
+	if !report.OK() && !report.Fixed {
+		return errors.New("wallet check found problems")
+	}
+	return nil
+}
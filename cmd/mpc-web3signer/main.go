@@ -0,0 +1,124 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// mpc-web3signer serves the accounts of MPC wallets over the Web3Signer HTTP API.
+//
+// Usage:
+//
+//	mpc-web3signer --base-dir=/path/to/wallets --passphrase-file=/path/to/passphrase [--wallet=name]... [--listen=localhost:9000] [--allow-unprotected-signing]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/web3signer"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// stringList is a flag that can be supplied multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	baseDir := flag.String("base-dir", "", "base directory of the wallet store")
+	listen := flag.String("listen", "localhost:9000", "address on which to listen")
+	timeout := flag.Duration("key-service-timeout", 30*time.Second, "timeout for requests to the key services of the wallets")
+	unprotectedSigning := flag.Bool("allow-unprotected-signing", false, "sign blocks and attestations without slashing protection")
+	var walletNames stringList
+	flag.Var(&walletNames, "wallet", "name of a wallet to serve (can be supplied multiple times; defaults to all wallets)")
+	var passphraseFiles stringList
+	flag.Var(&passphraseFiles, "passphrase-file", "file containing an account passphrase (can be supplied multiple times)")
+	flag.Parse()
+
+	if *baseDir == "" {
+		log.Fatal("--base-dir is required")
+	}
+	if len(passphraseFiles) == 0 {
+		log.Fatal("--passphrase-file is required")
+	}
+
+	if err := e2types.InitBLS(); err != nil {
+		log.Fatalf("failed to initialise BLS: %v", err)
+	}
+
+	ctx := context.Background()
+	passphrases, err := web3signer.PassphrasesFromFiles(passphraseFiles)
+	if err != nil {
+		log.Fatal(err)
+	}
+	wallets, err := openWallets(ctx, filesystem.New(*baseDir), walletNames, mpc.WithTimeout(*timeout))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := make([]web3signer.Option, 0)
+	if *unprotectedSigning {
+		opts = append(opts, web3signer.WithUnprotectedSigning())
+	}
+	service, err := web3signer.New(ctx, wallets, passphrases, opts...)
+	if err != nil {
+		log.Fatalf("failed to create service: %v", err)
+	}
+	if *unprotectedSigning {
+		log.Print("signing blocks and attestations without slashing protection")
+	}
+	log.Printf("serving %d accounts on %s", len(service.PublicKeys()), *listen)
+	log.Fatal(http.ListenAndServe(*listen, service))
+}
+
+// openWallets opens the named wallets, or all MPC wallets in the store if no names are supplied.
+func openWallets(ctx context.Context, store e2wtypes.Store, names []string, opts ...mpc.Option) ([]e2wtypes.Wallet, error) {
+	encryptor := keystorev4.New()
+	wallets := make([]e2wtypes.Wallet, 0)
+	if len(names) == 0 {
+		for data := range store.RetrieveWallets() {
+			wallet, err := mpc.DeserializeWallet(ctx, data, store, encryptor, opts...)
+			if err != nil {
+				// Not an MPC wallet.
+				continue
+			}
+			wallets = append(wallets, wallet)
+		}
+		if len(wallets) == 0 {
+			return nil, fmt.Errorf("no wallets found in %s", store.(*filesystem.Store).Location())
+		}
+		return wallets, nil
+	}
+
+	for _, name := range names {
+		wallet, err := mpc.OpenWallet(ctx, name, store, encryptor, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open wallet %q: %v", name, err)
+		}
+		wallets = append(wallets, wallet)
+	}
+	return wallets, nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// TestConcurrentLocking signs, locks, unlocks and creates accounts in parallel.
+// It is most useful when run with the race detector: go test -race -run TestConcurrentLocking
+func TestConcurrentLocking(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	// Use the null encryptor so that unlocking is cheap enough to do repeatedly.
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", nil, scratch.New(), &nullEncryptor{}, seed, keyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), nil))
+	signer, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Signer", nil)
+	require.NoError(t, err)
+	other, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Signer")
+	require.NoError(t, err)
+	data := []byte("concurrent")
+
+	const iterations = 50
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				f(i)
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		run(func(int) {
+			signature, err := signer.(e2wtypes.AccountSigner).Sign(context.Background(), data)
+			if err != nil {
+				assert.True(t, errors.Is(err, mpc.ErrLocked), err.Error())
+				return
+			}
+			assert.True(t, signature.Verify(data, signer.PublicKey()))
+		})
+	}
+	for _, account := range []e2wtypes.Account{signer, other} {
+		locker := account.(e2wtypes.AccountLocker)
+		run(func(i int) {
+			if i%2 == 0 {
+				assert.NoError(t, locker.Unlock(context.Background(), nil))
+			} else {
+				assert.NoError(t, locker.Lock(context.Background()))
+			}
+			_, err := locker.IsUnlocked(context.Background())
+			assert.NoError(t, err)
+		})
+	}
+	run(func(i int) {
+		if i%2 == 0 {
+			assert.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+		} else {
+			assert.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), nil))
+		}
+	})
+	run(func(i int) {
+		_, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("Account %d", i), nil)
+		if err != nil {
+			assert.True(t, errors.Is(err, mpc.ErrLocked), err.Error())
+		}
+	})
+	run(func(int) {
+		_, err := wallet.(e2wtypes.WalletLocker).IsUnlocked(context.Background())
+		assert.NoError(t, err)
+		_, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Signer")
+		assert.NoError(t, err)
+		for range wallet.Accounts(context.Background()) {
+		}
+	})
+	wg.Wait()
+
+	// The wallet's index is consistent with its accounts.
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), nil))
+	report, err := wallet.(walletVerifier).VerifyAndRepair(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, report.Mismatched, 0)
+	assert.Len(t, report.Missing, 0)
+	names := make(map[string]bool)
+	for account := range wallet.Accounts(context.Background()) {
+		names[account.Name()] = true
+	}
+	assert.Len(t, names, len(report.Verified))
+	assert.True(t, names["Signer"])
+}
@@ -0,0 +1,153 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// accountDeleter is the interface for stores that can delete accounts.
+type accountDeleter interface {
+	DeleteAccount(walletID uuid.UUID, accountID uuid.UUID) error
+}
+
+// DeleteAccount deletes the account with the given ID from the wallet.
+// The wallet must be unlocked, the account must not be unlocked, and the wallet's store must support deletion of
+// accounts.
+// The remote share of the account is kept by the key service.  The key service holds a single remote share for all of
+// the accounts, in this and other wallets, that use it, and neither of the key service protocols can destroy a share,
+// so it must be destroyed at the key service once nothing uses it.
+func (w *wallet) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	a, err := w.retirableAccount(ctx, id, "delete")
+	if err != nil {
+		return err
+	}
+	deleter, isDeleter := w.store.(accountDeleter)
+	if !isDeleter {
+		return errors.New("store does not support deletion of accounts")
+	}
+
+	if err := deleter.DeleteAccount(w.id, id); err != nil {
+		return errors.Wrapf(err, "failed to delete account %q", a.name)
+	}
+	w.retireAccount(id, newErrorf(ErrNotFound, "account %q has been deleted", a.name))
+	w.removeFromIndex(id, a.name)
+	if err := w.storeAccountsIndex(); err != nil {
+		return errors.Wrapf(err, "failed to update index after deleting account %q", a.name)
+	}
+
+	return nil
+}
+
+// ArchiveAccount archives the account with the given ID.
+// An archived account remains in the wallet, but cannot be unlocked and so cannot sign.
+// The wallet must be unlocked, and the account must not be unlocked.
+func (w *wallet) ArchiveAccount(ctx context.Context, id uuid.UUID) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	a, err := w.retirableAccount(ctx, id, "archive")
+	if err != nil {
+		return err
+	}
+	if a.archived {
+		return nil
+	}
+
+	a.archived = true
+	// The index records the flag too, so that the account is recreated archived if its record is lost.
+	w.updateIndexFlags(a)
+	if err := a.storeAccount(); err != nil {
+		a.archived = false
+		w.updateIndexFlags(a)
+		return errors.Wrapf(err, "failed to store archived account %q", a.name)
+	}
+	w.retireAccount(id, newErrorf(ErrArchived, "account %q is archived", a.name))
+
+	return nil
+}
+
+// retirableAccount fetches an account that is to be deleted or archived, checking that the wallet is unlocked and
+// that the account is not.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) retirableAccount(ctx context.Context, id uuid.UUID, action string) (*account, error) {
+	if !w.isUnlocked() {
+		return nil, newErrorf(ErrLocked, "wallet must be unlocked to %s accounts", action)
+	}
+	name, exists := w.index.Name(id)
+	if !exists {
+		return nil, newError(ErrNotFound, "account not found")
+	}
+	if w.accountUnlockedCount(id) > 0 {
+		return nil, fmt.Errorf("account %q must be locked to %s it", name, action)
+	}
+	acc, err := w.accountByID(ctx, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to obtain account %q", name)
+	}
+	return acc.(*account), nil
+}
+
+// accountUnlocked records that an instance of an account has been unlocked.
+func (w *wallet) accountUnlocked(a *account) {
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	if w.unlockedAccounts == nil {
+		w.unlockedAccounts = make(map[uuid.UUID]int)
+	}
+	w.unlockedAccounts[a.id]++
+}
+
+// accountLocked records that an instance of an account has been locked.
+func (w *wallet) accountLocked(a *account) {
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	if w.unlockedAccounts[a.id] > 1 {
+		w.unlockedAccounts[a.id]--
+	} else {
+		delete(w.unlockedAccounts, a.id)
+	}
+}
+
+// accountUnlockedCount returns the number of unlocked instances of an account.
+func (w *wallet) accountUnlockedCount(id uuid.UUID) int {
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	return w.unlockedAccounts[id]
+}
+
+// retireAccount records that an account has been deleted or archived, so that instances of it that were obtained
+// beforehand cannot be unlocked.
+func (w *wallet) retireAccount(id uuid.UUID, reason error) {
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	if w.retiredAccounts == nil {
+		w.retiredAccounts = make(map[uuid.UUID]error)
+	}
+	w.retiredAccounts[id] = reason
+}
+
+// checkAccountRetired returns an error if an account has been deleted or archived.
+func (w *wallet) checkAccountRetired(id uuid.UUID) error {
+	w.accountsMutex.Lock()
+	defer w.accountsMutex.Unlock()
+	return w.retiredAccounts[id]
+}
@@ -0,0 +1,183 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type accountDeleter interface {
+	DeleteAccount(ctx context.Context, id uuid.UUID) error
+	ArchiveAccount(ctx context.Context, id uuid.UUID) error
+}
+
+func TestDeleteAccount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestDeleteAccount")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+
+	// Scratch stores cannot delete accounts.
+	scratchWallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte{}, scratch.New(), keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, scratchWallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+	scratchAccount, err := scratchWallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("test"))
+	require.NoError(t, err)
+	err = scratchWallet.(accountDeleter).DeleteAccount(context.Background(), scratchAccount.ID())
+	assert.EqualError(t, err, "store does not support deletion of accounts")
+
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte{}, filesystem.New(dir), keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("test"))
+	require.NoError(t, err)
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+	err = wallet.(accountDeleter).DeleteAccount(context.Background(), account.ID())
+	assert.EqualError(t, err, "wallet must be unlocked to delete accounts")
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+	err = wallet.(accountDeleter).DeleteAccount(context.Background(), uuid.New())
+	assert.EqualError(t, err, "account not found")
+
+	// Unlocked accounts cannot be deleted.
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("test")))
+	err = wallet.(accountDeleter).DeleteAccount(context.Background(), account.ID())
+	assert.EqualError(t, err, `account "Test" must be locked to delete it`)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Lock(context.Background()))
+
+	require.NoError(t, wallet.(accountDeleter).DeleteAccount(context.Background(), account.ID()))
+	// The deleted account cannot be unlocked.
+	err = account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("test"))
+	assert.EqualError(t, err, `account "Test" has been deleted`)
+	assert.True(t, errors.Is(err, mpc.ErrNotFound))
+	_, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Test")
+	assert.EqualError(t, err, `no account with name "Test"`)
+	_, err = wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), account.ID())
+	assert.Error(t, err)
+
+	// Confirm that the deletion is persisted.
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", filesystem.New(dir), keystorev4.New())
+	require.NoError(t, err)
+	_, err = reopened.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Test")
+	assert.EqualError(t, err, `no account with name "Test"`)
+}
+
+func TestDeleteAccountKeepsRemoteShare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestDeleteAccountKeepsRemoteShare")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+
+	requests := 0
+	keyService := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+	}))
+	defer keyService.Close()
+
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte{}, filesystem.New(dir), keystorev4.New(), seed, keyService.URL, pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+	account1, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 1", []byte("test"))
+	require.NoError(t, err)
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 2", []byte("test"))
+	require.NoError(t, err)
+
+	// The account is deleted without contacting the key service, which keeps the remote share.
+	require.NoError(t, wallet.(accountDeleter).DeleteAccount(context.Background(), account1.ID()))
+	assert.Equal(t, 0, requests)
+	_, err = wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), account1.ID())
+	assert.True(t, errors.Is(err, mpc.ErrNotFound))
+
+	// Other accounts that use the remote share are unaffected.
+	_, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 2")
+	require.NoError(t, err)
+}
+
+func TestArchiveAccount(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte{}, store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("test"))
+	require.NoError(t, err)
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+	err = wallet.(accountDeleter).ArchiveAccount(context.Background(), account.ID())
+	assert.EqualError(t, err, "wallet must be unlocked to archive accounts")
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+
+	// Unlocked accounts cannot be archived.
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("test")))
+	err = wallet.(accountDeleter).ArchiveAccount(context.Background(), account.ID())
+	assert.EqualError(t, err, `account "Test" must be locked to archive it`)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Lock(context.Background()))
+
+	require.NoError(t, wallet.(accountDeleter).ArchiveAccount(context.Background(), account.ID()))
+	// Archiving is idempotent.
+	require.NoError(t, wallet.(accountDeleter).ArchiveAccount(context.Background(), account.ID()))
+
+	// The account obtained before archiving cannot be unlocked.
+	err = account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("test"))
+	assert.EqualError(t, err, `account "Test" is archived`)
+	assert.True(t, errors.Is(err, mpc.ErrArchived))
+
+	// The archived account remains in the wallet, but cannot be unlocked or sign.
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	archived, err := reopened.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Test")
+	require.NoError(t, err)
+	assert.True(t, archived.(interface{ IsArchived() bool }).IsArchived())
+	err = archived.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("test"))
+	assert.EqualError(t, err, "account is archived")
+	assert.True(t, errors.Is(err, mpc.ErrArchived))
+	_, err = archived.(e2wtypes.AccountSigner).Sign(context.Background(), []byte{0x01})
+	assert.True(t, errors.Is(err, mpc.ErrLocked))
+}
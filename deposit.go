@@ -0,0 +1,132 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	ssz "github.com/prysmaticlabs/go-ssz"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+)
+
+const (
+	// minDepositAmount is the minimum amount of a deposit, in Gwei.
+	minDepositAmount = uint64(1000000000)
+	// depositCLIVersion is the version of the deposit CLI whose output format is followed.
+	// The launchpad refuses deposit data without it.
+	depositCLIVersion = "2.7.0"
+)
+
+// networkNames maps fork versions to the network names used by the launchpad.
+var networkNames = map[string]string{
+	"00000000": "mainnet",
+	"00001020": "goerli",
+	"90000069": "sepolia",
+	"01017000": "holesky",
+	"10000910": "hoodi",
+}
+
+// depositMessage is the message signed for a deposit.
+type depositMessage struct {
+	PublicKey             []byte `ssz-size:"48"`
+	WithdrawalCredentials []byte `ssz-size:"32"`
+	Amount                uint64
+}
+
+// depositData is the data sent to the deposit contract.
+type depositData struct {
+	PublicKey             []byte `ssz-size:"48"`
+	WithdrawalCredentials []byte `ssz-size:"32"`
+	Amount                uint64
+	Signature             []byte `ssz-size:"96"`
+}
+
+// DepositData is the deposit data for an account, in the format generated by the deposit CLI.
+// The launchpad accepts a JSON array of these.
+type DepositData struct {
+	PublicKey             string `json:"pubkey"`
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+	Amount                uint64 `json:"amount"`
+	Signature             string `json:"signature"`
+	DepositMessageRoot    string `json:"deposit_message_root"`
+	DepositDataRoot       string `json:"deposit_data_root"`
+	ForkVersion           string `json:"fork_version"`
+	NetworkName           string `json:"network_name,omitempty"`
+	DepositCLIVersion     string `json:"deposit_cli_version"`
+}
+
+// DepositData generates signed deposit data for the account.
+// The deposit message is signed with both the local and remote shares, and the resultant signature is verified
+// against the aggregate public key before the deposit data is returned.
+// The account must be unlocked.
+func (a *account) DepositData(ctx context.Context, withdrawalCredentials []byte, amount uint64, forkVersion []byte) (*DepositData, error) {
+	if len(withdrawalCredentials) != 32 {
+		return nil, errors.New("withdrawal credentials must be 32 bytes")
+	}
+	if amount < minDepositAmount {
+		return nil, fmt.Errorf("deposit amount must be at least %d Gwei", minDepositAmount)
+	}
+	if len(forkVersion) != 4 {
+		return nil, errors.New("fork version must be 4 bytes")
+	}
+
+	publicKey := a.PublicKey()
+	if publicKey == nil {
+		return nil, errors.New("failed to obtain public key")
+	}
+
+	message := &depositMessage{
+		PublicKey:             publicKey.Marshal(),
+		WithdrawalCredentials: withdrawalCredentials,
+		Amount:                amount,
+	}
+	messageRoot, err := ssz.HashTreeRoot(message)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate deposit message root")
+	}
+
+	request, err := depositRequest(message, forkVersion)
+	if err != nil {
+		return nil, err
+	}
+	domain := e2types.Domain(e2types.DomainDeposit, forkVersion, e2types.ZeroGenesisValidatorsRoot)
+	signature, err := a.signObjectRoot(ctx, messageRoot[:], domain, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign deposit message")
+	}
+
+	dataRoot, err := ssz.HashTreeRoot(&depositData{
+		PublicKey:             message.PublicKey,
+		WithdrawalCredentials: message.WithdrawalCredentials,
+		Amount:                message.Amount,
+		Signature:             signature.Marshal(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate deposit data root")
+	}
+
+	return &DepositData{
+		PublicKey:             fmt.Sprintf("%x", message.PublicKey),
+		WithdrawalCredentials: fmt.Sprintf("%x", message.WithdrawalCredentials),
+		Amount:                amount,
+		Signature:             fmt.Sprintf("%x", signature.Marshal()),
+		DepositMessageRoot:    fmt.Sprintf("%x", messageRoot),
+		DepositDataRoot:       fmt.Sprintf("%x", dataRoot),
+		ForkVersion:           fmt.Sprintf("%x", forkVersion),
+		NetworkName:           networkNames[fmt.Sprintf("%x", forkVersion)],
+		DepositCLIVersion:     depositCLIVersion,
+	}, nil
+}
@@ -0,0 +1,183 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type depositDataProvider interface {
+	DepositData(ctx context.Context, withdrawalCredentials []byte, amount uint64, forkVersion []byte) (*mpc.DepositData, error)
+}
+
+func TestDepositData(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, keyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	withdrawalCredentials := _byteArray("00fad2a6bfb0e7f1f0f45460944fbd8dfa7f37da06a4d13b3983cc90bb46963b")
+	forkVersion := []byte{0x00, 0x00, 0x00, 0x00}
+
+	tests := []struct {
+		name                  string
+		withdrawalCredentials []byte
+		amount                uint64
+		forkVersion           []byte
+		unlock                bool
+		err                   string
+	}{
+		{
+			name:                  "Locked",
+			withdrawalCredentials: withdrawalCredentials,
+			amount:                32000000000,
+			forkVersion:           forkVersion,
+			err:                   "failed to sign deposit message: failed to sign: cannot sign when account is locked",
+		},
+		{
+			name:                  "WithdrawalCredentialsShort",
+			withdrawalCredentials: withdrawalCredentials[1:],
+			amount:                32000000000,
+			forkVersion:           forkVersion,
+			unlock:                true,
+			err:                   "withdrawal credentials must be 32 bytes",
+		},
+		{
+			name:                  "AmountLow",
+			withdrawalCredentials: withdrawalCredentials,
+			amount:                999999999,
+			forkVersion:           forkVersion,
+			unlock:                true,
+			err:                   "deposit amount must be at least 1000000000 Gwei",
+		},
+		{
+			name:                  "ForkVersionLong",
+			withdrawalCredentials: withdrawalCredentials,
+			amount:                32000000000,
+			forkVersion:           []byte{0x00, 0x00, 0x00, 0x00, 0x00},
+			unlock:                true,
+			err:                   "fork version must be 4 bytes",
+		},
+		{
+			name:                  "Good",
+			withdrawalCredentials: withdrawalCredentials,
+			amount:                32000000000,
+			forkVersion:           forkVersion,
+			unlock:                true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.unlock {
+				require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+				defer func() {
+					require.NoError(t, account.(e2wtypes.AccountLocker).Lock(context.Background()))
+				}()
+			}
+			depositData, err := account.(depositDataProvider).DepositData(context.Background(), test.withdrawalCredentials, test.amount, test.forkVersion)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%x", account.PublicKey().Marshal()), depositData.PublicKey)
+			assert.Equal(t, fmt.Sprintf("%x", test.withdrawalCredentials), depositData.WithdrawalCredentials)
+			assert.Equal(t, test.amount, depositData.Amount)
+			assert.Equal(t, "00000000", depositData.ForkVersion)
+			assert.Equal(t, "mainnet", depositData.NetworkName)
+			assert.Len(t, depositData.Signature, 192)
+			assert.Len(t, depositData.DepositMessageRoot, 64)
+			assert.Len(t, depositData.DepositDataRoot, 64)
+
+			data, err := json.Marshal([]*mpc.DepositData{depositData})
+			require.NoError(t, err)
+			var entries []map[string]interface{}
+			require.NoError(t, json.Unmarshal(data, &entries))
+			require.Len(t, entries, 1)
+			for _, key := range []string{"pubkey", "withdrawal_credentials", "amount", "signature", "deposit_message_root", "deposit_data_root", "fork_version", "network_name", "deposit_cli_version"} {
+				assert.Contains(t, entries[0], key)
+			}
+		})
+	}
+}
+
+func TestDepositDataKnownAnswer(t *testing.T) {
+	// The remote share is the first interop validator key, and the local share is derived from a fixed seed, so the
+	// deposit data is fully determined.
+	remoteKey, err := e2types.BLSPrivateKeyFromBytes(_byteArray("25295f0d1d592a90b333e26e85149708208e9f8e8bc18f6c77bd62f8ad7a6866"))
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, keyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+
+	depositData, err := account.(depositDataProvider).DepositData(context.Background(), _byteArray("00fad2a6bfb0e7f1f0f45460944fbd8dfa7f37da06a4d13b3983cc90bb46963b"), 32000000000, []byte{0x00, 0x00, 0x00, 0x00})
+	require.NoError(t, err)
+
+	// The roots were calculated independently of this library, following the SSZ definitions of DepositMessage and
+	// DepositData in the consensus specifications.
+	assert.Equal(t, "b68dcb5a910c50901a0b870927c93676cb802c508d28cc16b5c89bae96ffa2086166e2124668c5ca1ae7c01f01944ff7", depositData.PublicKey)
+	assert.Equal(t, "00fad2a6bfb0e7f1f0f45460944fbd8dfa7f37da06a4d13b3983cc90bb46963b", depositData.WithdrawalCredentials)
+	assert.Equal(t, uint64(32000000000), depositData.Amount)
+	assert.Equal(t, "874db700fa63d72ca1637e8c73555810be939176071758d725d53926125c846b12105a06317c8827a06117951196b834088fe45c7843b4948e9b705a797e5971c5972adf8d09263fecfcd582e9f28124b065d95653d0795b05f8fef519151efb", depositData.Signature)
+	assert.Equal(t, "931e84ae68859111728982b73fa6953cc0d53727bde5024f98febd15128517b5", depositData.DepositMessageRoot)
+	assert.Equal(t, "596bc2eebe4697a8b104ce97f1c449af9bdc1a3f5ee001d7fd9973d55e77647d", depositData.DepositDataRoot)
+
+	// The signature is over the signing root of the deposit message root with the mainnet deposit domain
+	// 0x03000000f5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a9.
+	signature, err := e2types.BLSSignatureFromBytes(_byteArray(depositData.Signature))
+	require.NoError(t, err)
+	publicKey, err := e2types.BLSPublicKeyFromBytes(_byteArray(depositData.PublicKey))
+	require.NoError(t, err)
+	assert.True(t, signature.Verify(_byteArray("8fc9ce9019e95b9f67d6cb24fdb0790d4a346ed7d1544d04c383e4fd5792df86"), publicKey))
+}
@@ -0,0 +1,73 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"fmt"
+	"sync"
+
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// legacyEncryptorName is the name of the encryptor for data stored before encryptors were recorded.
+const legacyEncryptorName = "keystore"
+
+var (
+	encryptorsMutex sync.RWMutex
+	// encryptors are the registered encryptors, keyed by name and version.
+	encryptors = map[string]e2wtypes.Encryptor{}
+)
+
+func init() {
+	RegisterEncryptor(keystorev4.New())
+}
+
+// encryptorKey provides the registry key for an encryptor with the given name and version.
+func encryptorKey(name string, version uint) string {
+	return fmt.Sprintf("%s/%d", name, version)
+}
+
+// RegisterEncryptor registers an encryptor so that data it protected can be decrypted regardless of the
+// encryptor with which the wallet was opened.  Registering an encryptor with the same name and version as an
+// existing one replaces it.  Encryptors for the keystore version 4 format are registered by default.
+func RegisterEncryptor(encryptor e2wtypes.Encryptor) {
+	encryptorsMutex.Lock()
+	defer encryptorsMutex.Unlock()
+	encryptors[encryptorKey(encryptor.Name(), encryptor.Version())] = encryptor
+}
+
+// resolveEncryptor provides the encryptor for data protected by the encryptor with the given name and version.
+// The preferred encryptor, usually that with which the wallet was opened, is used if it matches, so that any
+// parameters it carries are retained; otherwise the registered encryptor is used.
+func resolveEncryptor(preferred e2wtypes.Encryptor, name string, version uint) (e2wtypes.Encryptor, error) {
+	if name == "" {
+		name = legacyEncryptorName
+	}
+	if preferred != nil && preferred.Name() == name && preferred.Version() == version {
+		return preferred, nil
+	}
+
+	encryptorsMutex.RLock()
+	defer encryptorsMutex.RUnlock()
+	if encryptor, exists := encryptors[encryptorKey(name, version)]; exists {
+		return encryptor, nil
+	}
+	for _, encryptor := range encryptors {
+		if encryptor.Name() == name {
+			return nil, newErrorf(ErrUnsupportedVersion, "unsupported %s version", name)
+		}
+	}
+	return nil, newErrorf(ErrUnsupportedVersion, "unsupported encryptor %q", name)
+}
@@ -0,0 +1,106 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// hexEncryptor is a cheap encryptor that stores data and passphrase in the clear, to test mixing encryptors.
+type hexEncryptor struct {
+	name string
+}
+
+func (e *hexEncryptor) Name() string {
+	return e.name
+}
+
+func (e *hexEncryptor) Version() uint {
+	return 1
+}
+
+func (e *hexEncryptor) Encrypt(data []byte, passphrase string) (map[string]interface{}, error) {
+	return map[string]interface{}{"data": hex.EncodeToString(data), "passphrase": passphrase}, nil
+}
+
+func (e *hexEncryptor) Decrypt(data map[string]interface{}, passphrase string) ([]byte, error) {
+	if data["passphrase"] != passphrase {
+		return nil, errors.New("invalid passphrase")
+	}
+	return hex.DecodeString(data["data"].(string))
+}
+
+func TestMixedEncryptors(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	// Named uniquely as the registry is global.
+	custom := &hexEncryptor{name: fmt.Sprintf("hex-%s", uuid.New())}
+
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Keystore", []byte("keystore passphrase"))
+	require.NoError(t, err)
+
+	// Reopen with the custom encryptor; the seed is still decrypted with the keystore encryptor.
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, custom)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Custom", []byte("custom passphrase"))
+	require.NoError(t, err)
+	// Until the custom encryptor is registered, the account it protects cannot be used with the keystore encryptor.
+	keystoreWallet, err := mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	_, err = keystoreWallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Custom")
+	assert.EqualError(t, err, fmt.Sprintf("unsupported encryptor %q", custom.name))
+	assert.True(t, errors.Is(err, mpc.ErrUnsupportedVersion))
+	names := make([]string, 0)
+	for account := range keystoreWallet.Accounts(context.Background()) {
+		names = append(names, account.Name())
+	}
+	assert.Equal(t, []string{"Keystore"}, names)
+
+	// Changing the passphrase re-encrypts the seed with the custom encryptor.
+	require.NoError(t, wallet.(passphraseChanger).ChangePassphrase(context.Background(), []byte("wallet passphrase"), []byte("new wallet passphrase")))
+	_, err = mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	assert.True(t, errors.Is(err, mpc.ErrUnsupportedVersion))
+
+	mpc.RegisterEncryptor(custom)
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("new wallet passphrase")))
+	for name, passphrase := range map[string]string{"Keystore": "keystore passphrase", "Custom": "custom passphrase"} {
+		account, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), name)
+		require.NoError(t, err)
+		require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte(passphrase)))
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned by wallets, accounts and key services.  Returned errors carry more detailed messages,
+// so should be checked with errors.Is() rather than by comparison.
+var (
+	// ErrNotFound is returned when a wallet or account does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when a wallet or account with the same name or path already exists.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrLocked is returned when an operation requires an unlocked wallet or account.
+	ErrLocked = errors.New("locked")
+	// ErrIncorrectPassphrase is returned when a wallet or account cannot be unlocked with a passphrase.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+	// ErrKeyServiceUnavailable is returned when the key service cannot be reached.
+	ErrKeyServiceUnavailable = errors.New("key service unavailable")
+	// ErrKeyServiceRejected is returned when the key service does not provide a valid response to a request.
+	ErrKeyServiceRejected = errors.New("key service rejected request")
+	// ErrCorruptData is returned when stored data cannot be decoded or is inconsistent.
+	ErrCorruptData = errors.New("corrupt data")
+	// ErrUnsupportedVersion is returned when stored data has a version that is not supported.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrArchived is returned when an operation is attempted on an archived account.
+	ErrArchived = errors.New("archived")
+	// ErrUnsupportedRequest is returned when the key service cannot sign a request, for example when a key service
+	// that uses the Web3Signer protocol is asked to sign data without the details of the request.
+	ErrUnsupportedRequest = errors.New("unsupported request")
+)
+
+// walletError is an error with its own message that is also one of the sentinel errors.
+type walletError struct {
+	kind error
+	msg  string
+	err  error
+}
+
+// Error implements error.
+func (e *walletError) Error() string {
+	return e.msg
+}
+
+// Is returns true if the target is the sentinel error for this error.
+func (e *walletError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Unwrap returns the underlying error, if any.
+func (e *walletError) Unwrap() error {
+	return e.err
+}
+
+// newError creates an error of the given kind.
+func newError(kind error, msg string) error {
+	return &walletError{
+		kind: kind,
+		msg:  msg,
+	}
+}
+
+// newErrorf creates an error of the given kind with a formatted message.
+func newErrorf(kind error, format string, args ...interface{}) error {
+	return newError(kind, fmt.Sprintf(format, args...))
+}
+
+// markError marks an existing error as being of the given kind, retaining its message.
+func markError(kind error, err error) error {
+	return &walletError{
+		kind: kind,
+		msg:  err.Error(),
+		err:  err,
+	}
+}
+
+// wrapError wraps an existing error as being of the given kind, prefixing its message.
+func wrapError(kind error, err error, msg string) error {
+	return &walletError{
+		kind: kind,
+		msg:  fmt.Sprintf("%s: %v", msg, err),
+		err:  err,
+	}
+}
+
+// KeyServiceError is returned when a request to the key service fails.
+// It is ErrKeyServiceUnavailable if the key service could not be reached, and ErrKeyServiceRejected otherwise.
+type KeyServiceError struct {
+	// URL is the URL of the request.
+	URL string
+	// StatusCode is the HTTP status code of the response, or 0 if no response was received.
+	StatusCode int
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *KeyServiceError) Error() string {
+	return e.Err.Error()
+}
+
+// Is returns true if the target is the sentinel error for this error.
+func (e *KeyServiceError) Is(target error) bool {
+	if e.StatusCode == 0 {
+		return target == ErrKeyServiceUnavailable
+	}
+	return target == ErrKeyServiceRejected
+}
+
+// Unwrap returns the underlying error.
+func (e *KeyServiceError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,229 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+func TestErrors(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	rejectingKeyService := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Error(rw, "unknown key", http.StatusNotFound)
+	}))
+	defer rejectingKeyService.Close()
+	// Start and immediately stop a server to obtain an address that is not listening.
+	unavailableKeyService := httptest.NewServer(http.NotFoundHandler())
+	unavailableKeyService.Close()
+
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	rejectingWallet, err := mpc.CreateWallet(context.Background(), "rejecting", []byte("wallet passphrase"), store, encryptor, seed, rejectingKeyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	unavailableWallet, err := mpc.CreateWallet(context.Background(), "unavailable", []byte("wallet passphrase"), store, encryptor, seed, unavailableKeyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+
+	require.NoError(t, rejectingWallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	rejectingAccount, err := rejectingWallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, unavailableWallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	unavailableAccount, err := unavailableWallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, unavailableAccount.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	require.NoError(t, rejectingAccount.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+
+	tests := []struct {
+		name   string
+		run    func() error
+		target error
+		err    string
+	}{
+		{
+			name: "WalletNotFound",
+			run: func() error {
+				_, err := mpc.OpenWallet(context.Background(), "missing", store, encryptor)
+				return err
+			},
+			target: mpc.ErrNotFound,
+			err:    `wallet "missing" does not exist: wallet not found`,
+		},
+		{
+			name: "WalletAlreadyExists",
+			run: func() error {
+				_, err := mpc.CreateWallet(context.Background(), "rejecting", []byte("wallet passphrase"), store, encryptor, seed, rejectingKeyService.URL, remoteKey.PublicKey().Marshal())
+				return err
+			},
+			target: mpc.ErrAlreadyExists,
+			err:    `wallet "rejecting" already exists`,
+		},
+		{
+			name: "WalletIncorrectPassphrase",
+			run: func() error {
+				return rejectingWallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("bad"))
+			},
+			target: mpc.ErrIncorrectPassphrase,
+			err:    "incorrect passphrase",
+		},
+		{
+			name: "AccountNotFoundByName",
+			run: func() error {
+				_, err := rejectingWallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "missing")
+				return err
+			},
+			target: mpc.ErrNotFound,
+			err:    `no account with name "missing"`,
+		},
+		{
+			name: "AccountNotFoundByID",
+			run: func() error {
+				_, err := rejectingWallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), uuid.New())
+				return err
+			},
+			target: mpc.ErrNotFound,
+		},
+		{
+			name: "AccountAlreadyExists",
+			run: func() error {
+				_, err := rejectingWallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+				return err
+			},
+			target: mpc.ErrAlreadyExists,
+			err:    `account with name "Test" already exists`,
+		},
+		{
+			name: "AccountIncorrectPassphrase",
+			run: func() error {
+				return rejectingAccount.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("bad"))
+			},
+			target: mpc.ErrIncorrectPassphrase,
+			err:    "incorrect passphrase",
+		},
+		{
+			name: "KeyServiceRejected",
+			run: func() error {
+				_, err := rejectingAccount.(e2wtypes.AccountSigner).Sign(context.Background(), []byte("test"))
+				return err
+			},
+			target: mpc.ErrKeyServiceRejected,
+		},
+		{
+			name: "KeyServiceUnavailable",
+			run: func() error {
+				_, err := unavailableAccount.(e2wtypes.AccountSigner).Sign(context.Background(), []byte("test"))
+				return err
+			},
+			target: mpc.ErrKeyServiceUnavailable,
+		},
+		{
+			name: "WalletLocked",
+			run: func() error {
+				require.NoError(t, rejectingWallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+				_, err := rejectingWallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test 2", []byte("account passphrase"))
+				return err
+			},
+			target: mpc.ErrLocked,
+			err:    "wallet must be unlocked to create accounts",
+		},
+		{
+			name: "AccountLocked",
+			run: func() error {
+				require.NoError(t, rejectingAccount.(e2wtypes.AccountLocker).Lock(context.Background()))
+				_, err := rejectingAccount.(e2wtypes.AccountSigner).Sign(context.Background(), []byte("test"))
+				return err
+			},
+			target: mpc.ErrLocked,
+			err:    "cannot sign when account is locked",
+		},
+		{
+			name: "CorruptWallet",
+			run: func() error {
+				_, err := mpc.DeserializeWallet(context.Background(), []byte(`{}`), store, encryptor)
+				return err
+			},
+			target: mpc.ErrCorruptData,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.run()
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, test.target), err.Error())
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+			}
+		})
+	}
+
+	// Key service errors provide details of the failure.
+	require.NoError(t, rejectingAccount.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	_, err = rejectingAccount.(e2wtypes.AccountSigner).Sign(context.Background(), []byte("test"))
+	var keyServiceErr *mpc.KeyServiceError
+	require.True(t, errors.As(err, &keyServiceErr))
+	assert.Equal(t, http.StatusNotFound, keyServiceErr.StatusCode)
+	assert.False(t, errors.Is(err, mpc.ErrKeyServiceUnavailable))
+}
+
+type failingWalletStore struct {
+	*scratch.Store
+}
+
+func (s *failingWalletStore) RetrieveWallet(walletName string) ([]byte, error) {
+	return nil, errors.New("disk failure")
+}
+
+func TestCreateWalletStoreErrors(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+
+	// Failures to read the store are not reported as the wallet already existing.
+	store := &failingWalletStore{Store: scratch.New().(*scratch.Store)}
+	_, err := mpc.CreateWallet(context.Background(), "test wallet", []byte{}, store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.EqualError(t, err, `failed to check for existing wallet "test wallet": failed to retrieve wallet "test wallet": disk failure`)
+	assert.False(t, errors.Is(err, mpc.ErrAlreadyExists))
+	assert.False(t, errors.Is(err, mpc.ErrNotFound))
+
+	// Nor is a corrupt wallet.
+	corruptStore := scratch.New()
+	require.NoError(t, corruptStore.StoreWallet(uuid.New(), "test wallet", []byte(`{"name":"test wallet"}`)))
+	_, err = mpc.CreateWallet(context.Background(), "test wallet", []byte{}, corruptStore, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, mpc.ErrCorruptData), err.Error())
+	assert.False(t, errors.Is(err, mpc.ErrAlreadyExists))
+}
@@ -5,12 +5,14 @@ go 1.13
 require (
 	github.com/google/uuid v1.1.2
 	github.com/pkg/errors v0.9.1
+	github.com/prysmaticlabs/go-ssz v0.0.0-20200612203617-6d5c9aa213ae
 	github.com/stretchr/testify v1.5.1
+	github.com/tyler-smith/go-bip39 v1.1.0
 	github.com/wealdtech/go-ecodec v1.1.0
 	github.com/wealdtech/go-eth2-types/v2 v2.5.0
 	github.com/wealdtech/go-eth2-util v1.5.0
 	github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4 v1.1.0
-	github.com/wealdtech/go-eth2-wallet-store-scratch v1.6.0
 	github.com/wealdtech/go-eth2-wallet-types/v2 v2.7.0
 	github.com/wealdtech/go-indexer v1.0.0
+	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899
 )
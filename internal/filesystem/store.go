@@ -0,0 +1,238 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filesystem is a filesystem-based wallet store, using the same layout as
+// github.com/wealdtech/go-eth2-wallet-store-filesystem so that wallets can be moved between the two:
+//
+//	<base>/<wallet ID>/<wallet ID> holds the wallet
+//	<base>/<wallet ID>/<account ID> holds each account
+//	<base>/<wallet ID>/index holds the accounts index
+//
+// The upstream store is not used because it lacks two things that wallets here rely on:
+//   - DeleteAccount(), which a wallet's DeleteAccount() requires of its store;
+//   - atomic replacement of files.  A wallet's index is rewritten on every change to its accounts, and an
+//     interrupted write must not leave it, or an account, truncated.
+//
+// The store has nothing beyond these and the methods of e2wtypes.Store; in particular it does not support the
+// upstream store's optional encryption of its contents.
+package filesystem
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+const indexFile = "index"
+
+// notFoundError is returned when an item is not in the store.  It is os.ErrNotExist, so can be checked for with
+// errors.Is() rather than by its message.
+type notFoundError string
+
+// Error returns the message of the error.
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// Is returns true if the target is os.ErrNotExist.
+func (e notFoundError) Is(target error) bool {
+	return target == os.ErrNotExist
+}
+
+// Store is a filesystem-based wallet store.
+type Store struct {
+	location string
+}
+
+// New creates a new filesystem store at the given location.
+func New(location string) e2wtypes.Store {
+	return &Store{
+		location: location,
+	}
+}
+
+// Name returns the name of this store.
+func (s *Store) Name() string {
+	return "filesystem"
+}
+
+// Location returns the location of this store.
+func (s *Store) Location() string {
+	return s.location
+}
+
+// StoreWallet stores wallet data.
+func (s *Store) StoreWallet(walletID uuid.UUID, walletName string, data []byte) error {
+	return s.write(s.walletPath(walletID), walletID.String(), data)
+}
+
+// RetrieveWallet retrieves wallet data for a wallet with a given name.
+func (s *Store) RetrieveWallet(walletName string) ([]byte, error) {
+	for data := range s.RetrieveWallets() {
+		info := &struct {
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(data, info); err == nil && info.Name == walletName {
+			return data, nil
+		}
+	}
+	return nil, notFoundError("wallet not found")
+}
+
+// RetrieveWalletByID retrieves wallet data for a wallet with a given ID.
+func (s *Store) RetrieveWalletByID(walletID uuid.UUID) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.walletPath(walletID), walletID.String()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundError("wallet not found")
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// RetrieveWallets retrieves wallet data for all wallets.
+func (s *Store) RetrieveWallets() <-chan []byte {
+	ch := make(chan []byte, 1024)
+	go func() {
+		defer close(ch)
+		dirs, err := ioutil.ReadDir(s.location)
+		if err != nil {
+			return
+		}
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(s.location, dir.Name(), dir.Name()))
+			if err != nil {
+				continue
+			}
+			ch <- data
+		}
+	}()
+	return ch
+}
+
+// StoreAccount stores account data.
+func (s *Store) StoreAccount(walletID uuid.UUID, accountID uuid.UUID, data []byte) error {
+	if _, err := os.Stat(filepath.Join(s.walletPath(walletID), walletID.String())); err != nil {
+		if os.IsNotExist(err) {
+			return notFoundError("wallet not found")
+		}
+		return err
+	}
+	return s.write(s.walletPath(walletID), accountID.String(), data)
+}
+
+// RetrieveAccount retrieves account data for an account with a given ID.
+func (s *Store) RetrieveAccount(walletID uuid.UUID, accountID uuid.UUID) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.walletPath(walletID), accountID.String()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundError("account not found")
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// RetrieveAccounts retrieves account data for all accounts in a wallet.
+func (s *Store) RetrieveAccounts(walletID uuid.UUID) <-chan []byte {
+	ch := make(chan []byte, 1024)
+	go func() {
+		defer close(ch)
+		files, err := ioutil.ReadDir(s.walletPath(walletID))
+		if err != nil {
+			return
+		}
+		for _, file := range files {
+			if file.IsDir() || file.Name() == walletID.String() || file.Name() == indexFile {
+				continue
+			}
+			if _, err := uuid.Parse(file.Name()); err != nil {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(s.walletPath(walletID), file.Name()))
+			if err != nil {
+				continue
+			}
+			ch <- data
+		}
+	}()
+	return ch
+}
+
+// DeleteAccount deletes account data.
+func (s *Store) DeleteAccount(walletID uuid.UUID, accountID uuid.UUID) error {
+	if err := os.Remove(filepath.Join(s.walletPath(walletID), accountID.String())); err != nil {
+		if os.IsNotExist(err) {
+			return notFoundError("account not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// StoreAccountsIndex stores the accounts index for a wallet.
+func (s *Store) StoreAccountsIndex(walletID uuid.UUID, data []byte) error {
+	return s.write(s.walletPath(walletID), indexFile, data)
+}
+
+// RetrieveAccountsIndex retrieves the accounts index for a wallet.
+func (s *Store) RetrieveAccountsIndex(walletID uuid.UUID) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.walletPath(walletID), indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundError("index not found")
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// walletPath returns the path to the directory for a wallet.
+func (s *Store) walletPath(walletID uuid.UUID) string {
+	return filepath.Join(s.location, walletID.String())
+}
+
+// write writes data to a file, replacing any existing file atomically.
+func (s *Store) write(dir string, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, filepath.Join(dir, name))
+}
@@ -0,0 +1,82 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := filesystem.New(dir)
+	walletID := uuid.New()
+	accountID := uuid.New()
+
+	_, err = store.RetrieveWallet("test wallet")
+	require.EqualError(t, err, "wallet not found")
+	// Missing items can be checked for by type.
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	require.EqualError(t, store.StoreAccount(walletID, accountID, []byte(`{}`)), "wallet not found")
+
+	walletData := []byte(`{"uuid":"` + walletID.String() + `","name":"test wallet"}`)
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", walletData))
+	data, err := store.RetrieveWallet("test wallet")
+	require.NoError(t, err)
+	assert.Equal(t, walletData, data)
+	data, err = store.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	assert.Equal(t, walletData, data)
+
+	accountData := []byte(`{"uuid":"` + accountID.String() + `","name":"test account"}`)
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	data, err = store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, accountData, data)
+
+	_, err = store.RetrieveAccountsIndex(walletID)
+	require.EqualError(t, err, "index not found")
+	require.NoError(t, store.StoreAccountsIndex(walletID, []byte(`[]`)))
+	data, err = store.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`[]`), data)
+
+	// Only the account should be returned, not the wallet or index.
+	accounts := make([][]byte, 0)
+	for data := range store.RetrieveAccounts(walletID) {
+		accounts = append(accounts, data)
+	}
+	assert.Equal(t, [][]byte{accountData}, accounts)
+
+	wallets := make([][]byte, 0)
+	for data := range store.RetrieveWallets() {
+		wallets = append(wallets, data)
+	}
+	assert.Equal(t, [][]byte{walletData}, wallets)
+
+	require.NoError(t, store.(*filesystem.Store).DeleteAccount(walletID, accountID))
+	_, err = store.RetrieveAccount(walletID, accountID)
+	require.EqualError(t, err, "account not found")
+	require.EqualError(t, store.(*filesystem.Store).DeleteAccount(walletID, accountID), "account not found")
+}
@@ -0,0 +1,183 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scratch is an ephemeral in-memory wallet store, with the behaviour of
+// github.com/wealdtech/go-eth2-wallet-store-scratch.
+//
+// The upstream store is not used because it is not safe for concurrent use, nor for sequential use from a single
+// goroutine: its RetrieveWallet() and RetrieveAccount() return as soon as they find a match, leaving the goroutine
+// that feeds them reading its maps, so any later write races with that read.  This store takes a snapshot of its items
+// under a lock before providing them, so no reads of its maps outlive the calls that make them.
+//
+// As with the upstream store, stored data is retained rather than copied, and accounts cannot be deleted.
+package scratch
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// notFoundError is returned when an item is not in the store.  It is os.ErrNotExist, so can be checked for with
+// errors.Is() rather than by its message.
+type notFoundError string
+
+// Error returns the message of the error.
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// Is returns true if the target is os.ErrNotExist.
+func (e notFoundError) Is(target error) bool {
+	return target == os.ErrNotExist
+}
+
+// Store is an in-memory wallet store.
+type Store struct {
+	mutex        sync.RWMutex
+	wallets      map[uuid.UUID][]byte
+	accounts     map[uuid.UUID]map[uuid.UUID][]byte
+	accountIndex map[uuid.UUID][]byte
+}
+
+// New creates a new in-memory store.
+func New() e2wtypes.Store {
+	return &Store{
+		wallets:      make(map[uuid.UUID][]byte),
+		accounts:     make(map[uuid.UUID]map[uuid.UUID][]byte),
+		accountIndex: make(map[uuid.UUID][]byte),
+	}
+}
+
+// Name returns the name of this store.
+func (s *Store) Name() string {
+	return "scratch"
+}
+
+// StoreWallet stores wallet data.
+func (s *Store) StoreWallet(walletID uuid.UUID, walletName string, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.wallets[walletID] = data
+	if _, exists := s.accounts[walletID]; !exists {
+		s.accounts[walletID] = make(map[uuid.UUID][]byte)
+	}
+	return nil
+}
+
+// RetrieveWallet retrieves wallet data for a wallet with a given name.
+func (s *Store) RetrieveWallet(walletName string) ([]byte, error) {
+	for data := range s.RetrieveWallets() {
+		info := &struct {
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(data, info); err == nil && info.Name == walletName {
+			return data, nil
+		}
+	}
+	return nil, notFoundError("wallet not found")
+}
+
+// RetrieveWalletByID retrieves wallet data for a wallet with a given ID.
+func (s *Store) RetrieveWalletByID(walletID uuid.UUID) ([]byte, error) {
+	for data := range s.RetrieveWallets() {
+		info := &struct {
+			ID uuid.UUID `json:"uuid"`
+		}{}
+		if err := json.Unmarshal(data, info); err == nil && info.ID == walletID {
+			return data, nil
+		}
+	}
+	return nil, notFoundError("wallet not found")
+}
+
+// RetrieveWallets retrieves wallet data for all wallets.
+func (s *Store) RetrieveWallets() <-chan []byte {
+	s.mutex.RLock()
+	wallets := make([][]byte, 0, len(s.wallets))
+	for _, data := range s.wallets {
+		wallets = append(wallets, data)
+	}
+	s.mutex.RUnlock()
+	return provide(wallets)
+}
+
+// StoreAccount stores account data.
+func (s *Store) StoreAccount(walletID uuid.UUID, accountID uuid.UUID, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	accounts, exists := s.accounts[walletID]
+	if !exists {
+		return notFoundError("wallet not found")
+	}
+	accounts[accountID] = data
+	return nil
+}
+
+// RetrieveAccount retrieves account data for an account with a given ID.
+// As with the upstream store, accounts are matched on the ID in their data, so those without a decodable ID are
+// not found.
+func (s *Store) RetrieveAccount(walletID uuid.UUID, accountID uuid.UUID) ([]byte, error) {
+	for data := range s.RetrieveAccounts(walletID) {
+		info := &struct {
+			ID uuid.UUID `json:"uuid"`
+		}{}
+		if err := json.Unmarshal(data, info); err == nil && info.ID == accountID {
+			return data, nil
+		}
+	}
+	return nil, notFoundError("account not found")
+}
+
+// RetrieveAccounts retrieves account data for all accounts in a wallet.
+func (s *Store) RetrieveAccounts(walletID uuid.UUID) <-chan []byte {
+	s.mutex.RLock()
+	accounts := make([][]byte, 0, len(s.accounts[walletID]))
+	for _, data := range s.accounts[walletID] {
+		accounts = append(accounts, data)
+	}
+	s.mutex.RUnlock()
+	return provide(accounts)
+}
+
+// StoreAccountsIndex stores the accounts index for a wallet.
+func (s *Store) StoreAccountsIndex(walletID uuid.UUID, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accountIndex[walletID] = data
+	return nil
+}
+
+// RetrieveAccountsIndex retrieves the accounts index for a wallet.
+func (s *Store) RetrieveAccountsIndex(walletID uuid.UUID) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	data, exists := s.accountIndex[walletID]
+	if !exists {
+		return nil, notFoundError("not found")
+	}
+	return data, nil
+}
+
+// provide provides items on a channel, which is closed once they have all been provided.
+func provide(items [][]byte) <-chan []byte {
+	ch := make(chan []byte, len(items))
+	for _, item := range items {
+		ch <- item
+	}
+	close(ch)
+	return ch
+}
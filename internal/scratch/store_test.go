@@ -0,0 +1,104 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scratch_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store := scratch.New()
+	walletID := uuid.New()
+	accountID := uuid.New()
+
+	_, err := store.RetrieveWallet("test wallet")
+	require.EqualError(t, err, "wallet not found")
+	// Missing items can be checked for by type.
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	require.EqualError(t, store.StoreAccount(walletID, accountID, []byte(`{}`)), "wallet not found")
+
+	walletData := []byte(`{"uuid":"` + walletID.String() + `","name":"test wallet"}`)
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", walletData))
+	data, err := store.RetrieveWallet("test wallet")
+	require.NoError(t, err)
+	assert.Equal(t, walletData, data)
+	data, err = store.RetrieveWalletByID(walletID)
+	require.NoError(t, err)
+	assert.Equal(t, walletData, data)
+
+	accountData := []byte(`{"uuid":"` + accountID.String() + `","name":"test account"}`)
+	require.NoError(t, store.StoreAccount(walletID, accountID, accountData))
+	data, err = store.RetrieveAccount(walletID, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, accountData, data)
+
+	// Accounts are matched on the ID in their data.
+	undecodableID := uuid.New()
+	require.NoError(t, store.StoreAccount(walletID, undecodableID, []byte(`bad`)))
+	_, err = store.RetrieveAccount(walletID, undecodableID)
+	require.EqualError(t, err, "account not found")
+
+	_, err = store.RetrieveAccountsIndex(walletID)
+	require.EqualError(t, err, "not found")
+	require.NoError(t, store.StoreAccountsIndex(walletID, []byte(`[]`)))
+	data, err = store.RetrieveAccountsIndex(walletID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`[]`), data)
+
+	accounts := make([][]byte, 0)
+	for data := range store.RetrieveAccounts(walletID) {
+		accounts = append(accounts, data)
+	}
+	assert.ElementsMatch(t, [][]byte{accountData, []byte(`bad`)}, accounts)
+}
+
+// TestStoreConcurrent is of most use when run with the race detector.
+func TestStoreConcurrent(t *testing.T) {
+	store := scratch.New()
+	walletID := uuid.New()
+	require.NoError(t, store.StoreWallet(walletID, "test wallet", []byte(`{"uuid":"`+walletID.String()+`","name":"test wallet"}`)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				accountID := uuid.New()
+				require.NoError(t, store.StoreAccount(walletID, accountID, []byte(fmt.Sprintf(`{"uuid":%q}`, accountID))))
+				_, err := store.RetrieveAccount(walletID, accountID)
+				require.NoError(t, err)
+				_, err = store.RetrieveWallet("test wallet")
+				require.NoError(t, err)
+				require.NoError(t, store.StoreAccountsIndex(walletID, []byte(`[]`)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	for range store.RetrieveAccounts(walletID) {
+		count++
+	}
+	assert.Equal(t, 8*50, count)
+}
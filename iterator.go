@@ -0,0 +1,193 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// AccountsFilter selects the accounts provided by IterateAccounts().
+type AccountsFilter struct {
+	// NamePrefix selects accounts whose names start with the prefix.
+	NamePrefix string
+	// Path selects accounts with the path, or a path below it.  For example "m/12381/3600/1" selects
+	// "m/12381/3600/1/0" but not "m/12381/3600/10/0".
+	Path string
+	// Offset is the number of selected accounts to skip.
+	Offset int
+	// Limit is the maximum number of accounts to provide; 0 provides all selected accounts.
+	Limit int
+}
+
+// AccountResult is a result from IterateAccounts().
+// Err is set if the account could not be obtained, in which case Account is nil.
+type AccountResult struct {
+	ID      uuid.UUID
+	Name    string
+	Account e2wtypes.Account
+	Err     error
+}
+
+// IterateAccounts provides the accounts in the wallet selected by the filter, ordered by name.
+// A nil filter provides all accounts.  Accounts are selected using the wallet's index, so only the selected accounts
+// are decoded, and those that cannot be retrieved are provided with an error.  Accounts that are in the store but
+// missing from the index are not provided; Check() reports them, and Accounts() provides them.
+// The channel is closed when all accounts have been provided, or when the context is cancelled.  Readers that stop
+// before the channel is closed must cancel the context to release the iterator.
+func (w *wallet) IterateAccounts(ctx context.Context, filter *AccountsFilter) <-chan *AccountResult {
+	if filter == nil {
+		filter = &AccountsFilter{}
+	}
+	ch := make(chan *AccountResult)
+
+	w.mutex.RLock()
+	entries, err := w.selectIndexEntries(filter)
+	var stored map[uuid.UUID][]byte
+	if err == nil {
+		stored = w.retrieveSelectedAccounts(entries)
+	}
+	w.mutex.RUnlock()
+	go func() {
+		defer close(ch)
+		if err != nil {
+			select {
+			case ch <- &AccountResult{Err: errors.Wrap(err, "failed to read index")}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			res := &AccountResult{
+				ID:   entry.ID,
+				Name: entry.Name,
+			}
+			if data, exists := stored[entry.ID]; exists {
+				res.Account, res.Err = deserializeAccount(w, data)
+			} else {
+				res.Err = newErrorf(ErrNotFound, "account %q not found", entry.Name)
+			}
+			select {
+			case ch <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// retrieveSelectedAccounts retrieves the stored data of the accounts with the given index entries.
+// The data is obtained with a single pass over the store rather than an account at a time, as stores can scan all
+// of a wallet's accounts to retrieve one of them.  Only the IDs of accounts are decoded.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) retrieveSelectedAccounts(entries []*indexEntry) map[uuid.UUID][]byte {
+	selected := make(map[uuid.UUID]bool, len(entries))
+	for _, entry := range entries {
+		selected[entry.ID] = true
+	}
+	res := make(map[uuid.UUID][]byte, len(entries))
+	for data := range w.store.RetrieveAccounts(w.id) {
+		if id := recoverAccountID(data); selected[id] {
+			res[id] = data
+		}
+	}
+	return res
+}
+
+// selectIndexEntries returns the entries of the wallet's index selected by the filter, ordered by name.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) selectIndexEntries(filter *AccountsFilter) ([]*indexEntry, error) {
+	data := w.indexData
+	if data == nil {
+		var err error
+		if data, err = serializeIndex(w.index, w.paths, w.pubKeys, w.flags); err != nil {
+			return nil, err
+		}
+	}
+	var entries []*indexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	selected := make([]*indexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name, filter.NamePrefix) {
+			continue
+		}
+		if filter.Path != "" && entry.Path != filter.Path && !strings.HasPrefix(entry.Path, filter.Path+"/") {
+			continue
+		}
+		selected = append(selected, entry)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].Name != selected[j].Name {
+			return selected[i].Name < selected[j].Name
+		}
+		return selected[i].ID.String() < selected[j].ID.String()
+	})
+
+	if filter.Offset > 0 {
+		if filter.Offset >= len(selected) {
+			return selected[:0], nil
+		}
+		selected = selected[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(selected) {
+		selected = selected[:filter.Limit]
+	}
+	return selected, nil
+}
+
+// retrieveStoredAccounts retrieves the data of all accounts in the wallet's store.
+// The store's channel is drained before returning, so the store is not read once the lock on the wallet is released.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) retrieveStoredAccounts() [][]byte {
+	stored := make([][]byte, 0)
+	for data := range w.store.RetrieveAccounts(w.id) {
+		stored = append(stored, data)
+	}
+	return stored
+}
+
+// decodeAccounts decodes the data of stored accounts, skipping accounts that cannot be decoded.
+func (w *wallet) decodeAccounts(stored [][]byte) []*account {
+	accounts := make([]*account, 0, len(stored))
+	for _, data := range stored {
+		a, err := deserializeAccount(w, data)
+		if err != nil {
+			continue
+		}
+		accounts = append(accounts, a.(*account))
+	}
+	return accounts
+}
+
+// scanAccounts returns all decodable accounts in the wallet's store, regardless of the wallet's index.
+func (w *wallet) scanAccounts() []*account {
+	w.mutex.RLock()
+	stored := w.retrieveStoredAccounts()
+	w.mutex.RUnlock()
+	return w.decodeAccounts(stored)
+}
@@ -0,0 +1,190 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type accountsIterator interface {
+	IterateAccounts(ctx context.Context, filter *mpc.AccountsFilter) <-chan *mpc.AccountResult
+}
+
+func TestIterateAccounts(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	for _, name := range []string{"Validator 3", "Validator 1", "Backup", "Validator 2", "Validator 10"} {
+		_, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), name, []byte("account passphrase"))
+		require.NoError(t, err)
+	}
+	// Accounts are created at m/12381/3600/0/0 to m/12381/3600/4/0, so "Validator 10" is at m/12381/3600/4/0.
+	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/40/0", "Validator 40", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		filter *mpc.AccountsFilter
+		names  []string
+	}{
+		{
+			name:  "Nil",
+			names: []string{"Backup", "Validator 1", "Validator 10", "Validator 2", "Validator 3", "Validator 40"},
+		},
+		{
+			name:   "NamePrefix",
+			filter: &mpc.AccountsFilter{NamePrefix: "Validator 1"},
+			names:  []string{"Validator 1", "Validator 10"},
+		},
+		{
+			name:   "NamePrefixNone",
+			filter: &mpc.AccountsFilter{NamePrefix: "Other"},
+			names:  []string{},
+		},
+		{
+			name:   "Path",
+			filter: &mpc.AccountsFilter{Path: "m/12381/3600/4"},
+			names:  []string{"Validator 10"},
+		},
+		{
+			name:   "PathExact",
+			filter: &mpc.AccountsFilter{Path: "m/12381/3600/40/0"},
+			names:  []string{"Validator 40"},
+		},
+		{
+			name:   "PathAndNamePrefix",
+			filter: &mpc.AccountsFilter{Path: "m/12381/3600", NamePrefix: "B"},
+			names:  []string{"Backup"},
+		},
+		{
+			name:   "Page1",
+			filter: &mpc.AccountsFilter{Limit: 4},
+			names:  []string{"Backup", "Validator 1", "Validator 10", "Validator 2"},
+		},
+		{
+			name:   "Page2",
+			filter: &mpc.AccountsFilter{Offset: 4, Limit: 4},
+			names:  []string{"Validator 3", "Validator 40"},
+		},
+		{
+			name:   "OffsetBeyondEnd",
+			filter: &mpc.AccountsFilter{Offset: 10},
+			names:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := make([]string, 0)
+			for res := range wallet.(accountsIterator).IterateAccounts(context.Background(), test.filter) {
+				require.NoError(t, res.Err)
+				assert.Equal(t, res.Name, res.Account.Name())
+				assert.Equal(t, res.ID, res.Account.ID())
+				names = append(names, res.Name)
+			}
+			assert.Equal(t, test.names, names)
+		})
+	}
+}
+
+func TestIterateAccountsErrors(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 1", []byte("account passphrase"))
+	require.NoError(t, err)
+	corrupt, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 2", []byte("account passphrase"))
+	require.NoError(t, err)
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 3", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccount(wallet.ID(), corrupt.ID(), []byte(fmt.Sprintf(`{"uuid":"%s","name":"Account 2"}`, corrupt.ID()))))
+
+	results := make([]*mpc.AccountResult, 0)
+	for res := range wallet.(accountsIterator).IterateAccounts(context.Background(), nil) {
+		results = append(results, res)
+	}
+	require.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, corrupt.ID(), results[1].ID)
+	assert.Equal(t, "Account 2", results[1].Name)
+	assert.True(t, errors.Is(results[1].Err, mpc.ErrCorruptData))
+	assert.Nil(t, results[1].Account)
+	assert.NoError(t, results[2].Err)
+
+	// Accounts skips the account in error.
+	names := make([]string, 0)
+	for account := range wallet.Accounts(context.Background()) {
+		names = append(names, account.Name())
+	}
+	assert.ElementsMatch(t, []string{"Account 1", "Account 3"}, names)
+
+	// Accounts provides accounts missing from the index, which IterateAccounts does not.
+	data, err := store.RetrieveAccount(wallet.ID(), results[2].ID)
+	require.NoError(t, err)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &record))
+	unindexedID := uuid.New()
+	record["uuid"] = unindexedID.String()
+	record["name"] = "Unindexed"
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccount(wallet.ID(), unindexedID, data))
+	names = make([]string, 0)
+	for account := range wallet.Accounts(context.Background()) {
+		names = append(names, account.Name())
+	}
+	assert.ElementsMatch(t, []string{"Account 1", "Account 3", "Unindexed"}, names)
+	results = make([]*mpc.AccountResult, 0)
+	for res := range wallet.(accountsIterator).IterateAccounts(context.Background(), nil) {
+		results = append(results, res)
+	}
+	assert.Len(t, results, 3)
+
+	// Cancelling the context stops the iteration.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := wallet.(accountsIterator).IterateAccounts(ctx, nil)
+	res := <-ch
+	assert.Equal(t, "Account 1", res.Name)
+	cancel()
+	for range ch {
+	}
+}
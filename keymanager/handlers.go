@@ -0,0 +1,283 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keymanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+const (
+	statusDuplicate = "duplicate"
+	statusDeleted   = "deleted"
+	statusNotFound  = "not_found"
+	statusError     = "error"
+
+	// interchangeFormatVersion is the version of the EIP-3076 slashing protection interchange format.
+	interchangeFormatVersion = "5"
+)
+
+// keystore is an entry in the list of keystores.
+type keystore struct {
+	ValidatingPubkey string `json:"validating_pubkey"`
+	DerivationPath   string `json:"derivation_path,omitempty"`
+	Readonly         bool   `json:"readonly"`
+}
+
+// remoteKey is an entry in the list of remote keys.
+type remoteKey struct {
+	Pubkey   string `json:"pubkey"`
+	URL      string `json:"url"`
+	Readonly bool   `json:"readonly"`
+}
+
+// operationStatus is the status of an operation on a single key.
+type operationStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// importKeystoresRequest is the body of a request to import keystores.
+type importKeystoresRequest struct {
+	Keystores          []string `json:"keystores"`
+	Passwords          []string `json:"passwords"`
+	SlashingProtection string   `json:"slashing_protection,omitempty"`
+}
+
+// deleteKeystoresRequest is the body of a request to delete keystores.
+type deleteKeystoresRequest struct {
+	Pubkeys []string `json:"pubkeys"`
+}
+
+// deleteKeystoresResponse is the body of the response to a request to delete keystores.
+type deleteKeystoresResponse struct {
+	Data               []*operationStatus `json:"data"`
+	SlashingProtection string             `json:"slashing_protection"`
+}
+
+// createAccountRequest is the body of a request to create an account.
+type createAccountRequest struct {
+	Name       string `json:"name"`
+	Passphrase string `json:"passphrase"`
+}
+
+// interchange is an EIP-3076 slashing protection interchange.
+type interchange struct {
+	Metadata *interchangeMetadata `json:"metadata"`
+	Data     []*interchangeData   `json:"data"`
+}
+
+type interchangeMetadata struct {
+	InterchangeFormatVersion string `json:"interchange_format_version"`
+	GenesisValidatorsRoot    string `json:"genesis_validators_root"`
+}
+
+type interchangeData struct {
+	Pubkey             string        `json:"pubkey"`
+	SignedBlocks       []interface{} `json:"signed_blocks"`
+	SignedAttestations []interface{} `json:"signed_attestations"`
+}
+
+// listKeystores lists the accounts of the wallet.
+func (s *Service) listKeystores(rw http.ResponseWriter, req *http.Request) {
+	accounts, err := s.accounts(req.Context())
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	keystores := make([]*keystore, 0, len(accounts))
+	for pubkey, account := range accounts {
+		entry := &keystore{
+			ValidatingPubkey: pubkey,
+		}
+		if pathProvider, isProvider := account.(e2wtypes.AccountPathProvider); isProvider {
+			entry.DerivationPath = pathProvider.Path()
+		}
+		keystores = append(keystores, entry)
+	}
+	sort.Slice(keystores, func(i, j int) bool {
+		return keystores[i].ValidatingPubkey < keystores[j].ValidatingPubkey
+	})
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{"data": keystores})
+}
+
+// importKeystores handles a request to import keystores.
+// MPC accounts cannot be created from keystores, so every keystore is either a duplicate or an error.
+func (s *Service) importKeystores(rw http.ResponseWriter, req *http.Request) {
+	request := &importKeystoresRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(request.Keystores) != len(request.Passwords) {
+		writeError(rw, http.StatusBadRequest, "number of keystores and passwords differ")
+		return
+	}
+	accounts, err := s.accounts(req.Context())
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	statuses := make([]*operationStatus, len(request.Keystores))
+	for i, data := range request.Keystores {
+		ks := &struct {
+			Pubkey string `json:"pubkey"`
+		}{}
+		if err := json.Unmarshal([]byte(data), ks); err != nil {
+			statuses[i] = &operationStatus{Status: statusError, Message: "invalid keystore"}
+			continue
+		}
+		if _, exists := accounts[normalizePubkey(ks.Pubkey)]; exists {
+			statuses[i] = &operationStatus{Status: statusDuplicate}
+			continue
+		}
+		statuses[i] = &operationStatus{Status: statusError, Message: "keystores cannot be imported into an MPC wallet"}
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{"data": statuses})
+}
+
+// deleteKeystores deletes accounts from the wallet, returning slashing protection data for them.
+// The wallet does not sign, so it knows nothing of the signing history of its accounts.  The slashing protection
+// data is an interchange with no entries, rather than one that claims the deleted keys have not signed; the history
+// must be exported from the validator client that signed with the keys.
+func (s *Service) deleteKeystores(rw http.ResponseWriter, req *http.Request) {
+	request := &deleteKeystoresRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	accounts, err := s.accounts(req.Context())
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.wallet.Unlock(req.Context(), s.walletPassphrase); err != nil {
+		writeError(rw, http.StatusInternalServerError, "failed to unlock wallet")
+		return
+	}
+	defer s.wallet.Lock(req.Context())
+
+	statuses := make([]*operationStatus, len(request.Pubkeys))
+	for i, pubkey := range request.Pubkeys {
+		pubkey = normalizePubkey(pubkey)
+		account, exists := accounts[pubkey]
+		if !exists {
+			statuses[i] = &operationStatus{Status: statusNotFound}
+			continue
+		}
+		if err := s.wallet.DeleteAccount(req.Context(), account.ID()); err != nil {
+			statuses[i] = &operationStatus{Status: statusError, Message: err.Error()}
+			continue
+		}
+		delete(accounts, pubkey)
+		statuses[i] = &operationStatus{Status: statusDeleted}
+	}
+
+	data, err := json.Marshal(&interchange{
+		Metadata: &interchangeMetadata{
+			InterchangeFormatVersion: interchangeFormatVersion,
+			GenesisValidatorsRoot:    fmt.Sprintf("%#x", s.genesisValidatorsRoot),
+		},
+		Data: make([]*interchangeData, 0),
+	})
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, "failed to marshal slashing protection")
+		return
+	}
+	writeJSON(rw, http.StatusOK, &deleteKeystoresResponse{
+		Data:               statuses,
+		SlashingProtection: string(data),
+	})
+}
+
+// listRemoteKeys lists the accounts of the wallet with a remote share, along with the key service that holds it.
+func (s *Service) listRemoteKeys(rw http.ResponseWriter, req *http.Request) {
+	accounts, err := s.accounts(req.Context())
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	remoteKeys := make([]*remoteKey, 0, len(accounts))
+	for pubkey, account := range accounts {
+		if localProvider, isProvider := account.(interface{ IsLocal() bool }); isProvider && localProvider.IsLocal() {
+			continue
+		}
+		remoteKeys = append(remoteKeys, &remoteKey{
+			Pubkey: pubkey,
+			URL:    s.wallet.KeyServiceURL(),
+			// Remote shares are managed by the key service, not through this API.
+			Readonly: true,
+		})
+	}
+	sort.Slice(remoteKeys, func(i, j int) bool {
+		return remoteKeys[i].Pubkey < remoteKeys[j].Pubkey
+	})
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{"data": remoteKeys})
+}
+
+// createAccount creates a new account in the wallet.
+func (s *Service) createAccount(rw http.ResponseWriter, req *http.Request) {
+	request := &createAccountRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.wallet.Unlock(req.Context(), s.walletPassphrase); err != nil {
+		writeError(rw, http.StatusInternalServerError, "failed to unlock wallet")
+		return
+	}
+	defer s.wallet.Lock(req.Context())
+
+	account, err := s.wallet.CreateAccount(req.Context(), request.Name, []byte(request.Passphrase))
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	publicKey := account.(e2wtypes.AccountPublicKeyProvider).PublicKey()
+	if publicKey == nil {
+		writeError(rw, http.StatusInternalServerError, "failed to obtain public key")
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{"data": &keystore{
+		ValidatingPubkey: fmt.Sprintf("%#x", publicKey.Marshal()),
+		DerivationPath:   account.(e2wtypes.AccountPathProvider).Path(),
+	}})
+}
+
+// normalizePubkey returns a public key as lower-case 0x-prefixed hex.
+func normalizePubkey(pubkey string) string {
+	pubkey = strings.ToLower(pubkey)
+	if !strings.HasPrefix(pubkey, "0x") {
+		pubkey = "0x" + pubkey
+	}
+	return pubkey
+}
@@ -0,0 +1,183 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keymanager provides the Ethereum Keymanager API for the accounts of an MPC wallet.
+// Keystores cannot be imported, as MPC accounts require a remote share, so accounts are instead created
+// with an extension endpoint.
+package keymanager
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+const (
+	keystoresPath  = "/eth/v1/keystores"
+	remoteKeysPath = "/eth/v1/remotekeys"
+	// accountsPath is the extension endpoint for creating accounts.
+	accountsPath = "/eth/v1/mpc/accounts"
+)
+
+// managedWallet is the interface for wallets managed by the service.
+type managedWallet interface {
+	e2wtypes.Wallet
+	e2wtypes.WalletLocker
+	e2wtypes.WalletAccountCreator
+	DeleteAccount(ctx context.Context, id uuid.UUID) error
+	KeyServiceURL() string
+}
+
+// Service is an Ethereum Keymanager API service for an MPC wallet.
+type Service struct {
+	// mutex serialises operations that unlock the wallet.
+	mutex                 sync.Mutex
+	wallet                managedWallet
+	walletPassphrase      []byte
+	token                 string
+	genesisValidatorsRoot []byte
+}
+
+// New creates a new keymanager service for the given wallet.
+// The wallet passphrase is used to unlock the wallet when creating and deleting accounts.  Requests must
+// supply the token as a bearer token.  The genesis validators root is used in slashing protection exports.
+func New(ctx context.Context, wallet e2wtypes.Wallet, walletPassphrase []byte, token string, genesisValidatorsRoot []byte) (*Service, error) {
+	w, isManaged := wallet.(managedWallet)
+	if !isManaged {
+		return nil, errors.New("wallet is not an MPC wallet")
+	}
+	if token == "" {
+		return nil, errors.New("token missing")
+	}
+	if len(genesisValidatorsRoot) != 32 {
+		return nil, errors.New("genesis validators root must be 32 bytes")
+	}
+	// Confirm the passphrase up front, rather than on the first request.
+	if err := w.Unlock(ctx, walletPassphrase); err != nil {
+		return nil, errors.Wrap(err, "failed to unlock wallet")
+	}
+	if err := w.Lock(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to lock wallet")
+	}
+
+	return &Service{
+		wallet:                w,
+		walletPassphrase:      walletPassphrase,
+		token:                 token,
+		genesisValidatorsRoot: genesisValidatorsRoot,
+	}, nil
+}
+
+// errorResponse is the body of an error response.
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !s.authorize(rw, req) {
+		return
+	}
+
+	switch req.URL.Path {
+	case keystoresPath:
+		switch req.Method {
+		case http.MethodGet:
+			s.listKeystores(rw, req)
+		case http.MethodPost:
+			s.importKeystores(rw, req)
+		case http.MethodDelete:
+			s.deleteKeystores(rw, req)
+		default:
+			writeError(rw, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case remoteKeysPath:
+		if req.Method != http.MethodGet {
+			writeError(rw, http.StatusMethodNotAllowed, "remote keys are managed by the wallet's key service")
+			return
+		}
+		s.listRemoteKeys(rw, req)
+	case accountsPath:
+		if req.Method != http.MethodPost {
+			writeError(rw, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.createAccount(rw, req)
+	default:
+		writeError(rw, http.StatusNotFound, "not found")
+	}
+}
+
+// authorize checks the bearer token of the request, writing an error response if it is not valid.
+func (s *Service) authorize(rw http.ResponseWriter, req *http.Request) bool {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		writeError(rw, http.StatusUnauthorized, "bearer token missing")
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		writeError(rw, http.StatusForbidden, "bearer token invalid")
+		return false
+	}
+	return true
+}
+
+// accounts returns the validating accounts of the wallet, keyed by their 0x-prefixed aggregate public key.
+// Withdrawal accounts are not validating keys, so are not managed through the API.
+func (s *Service) accounts(ctx context.Context) (map[string]e2wtypes.Account, error) {
+	accounts := make(map[string]e2wtypes.Account)
+	for account := range s.wallet.Accounts(ctx) {
+		if signingProvider, isProvider := account.(interface{ SigningAccountID() uuid.UUID }); isProvider && signingProvider.SigningAccountID() != uuid.Nil {
+			continue
+		}
+		pubKeyProvider, isProvider := account.(e2wtypes.AccountPublicKeyProvider)
+		if !isProvider {
+			continue
+		}
+		publicKey := pubKeyProvider.PublicKey()
+		if publicKey == nil {
+			return nil, fmt.Errorf("failed to obtain public key for account %q", account.Name())
+		}
+		accounts[fmt.Sprintf("%#x", publicKey.Marshal())] = account
+	}
+	return accounts, nil
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(rw http.ResponseWriter, status int, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, "failed to marshal response")
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(body)
+}
+
+// writeError writes an error response.
+func writeError(rw http.ResponseWriter, status int, message string) {
+	body, _ := json.Marshal(&errorResponse{Message: message})
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(body)
+}
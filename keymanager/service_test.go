@@ -0,0 +1,164 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keymanager_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/keymanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+func TestMain(m *testing.M) {
+	if err := e2types.InitBLS(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// _request is a helper to send a request to the service, returning the status code and decoded body.
+func _request(t *testing.T, server *httptest.Server, method string, path string, token string, body string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	res := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(data, &res), string(data))
+	return resp.StatusCode, res
+}
+
+func TestService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestService")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), filesystem.New(dir), keystorev4.New(), seed, "http://localhost:8000", remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test 1", []byte("account passphrase"))
+	require.NoError(t, err)
+	// Withdrawal accounts are not validating keys, and are not listed.
+	_, err = wallet.(interface {
+		CreateWithdrawalAccount(context.Context, string, string, []byte, bool) (e2wtypes.Account, error)
+	}).CreateWithdrawalAccount(context.Background(), "Test 1", "Test 1 withdrawal", []byte("withdrawal passphrase"), true)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+	pubkey := fmt.Sprintf("%#x", account.(e2wtypes.AccountPublicKeyProvider).PublicKey().Marshal())
+
+	genesisValidatorsRoot := make([]byte, 32)
+	genesisValidatorsRoot[0] = 0x04
+	_, err = keymanager.New(context.Background(), wallet, []byte("bad"), "secret", genesisValidatorsRoot)
+	require.EqualError(t, err, "failed to unlock wallet: incorrect passphrase")
+	_, err = keymanager.New(context.Background(), wallet, []byte("wallet passphrase"), "", genesisValidatorsRoot)
+	require.EqualError(t, err, "token missing")
+	_, err = keymanager.New(context.Background(), wallet, []byte("wallet passphrase"), "secret", genesisValidatorsRoot[:31])
+	require.EqualError(t, err, "genesis validators root must be 32 bytes")
+	service, err := keymanager.New(context.Background(), wallet, []byte("wallet passphrase"), "secret", genesisValidatorsRoot)
+	require.NoError(t, err)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	// Authorization.
+	status, _ := _request(t, server, http.MethodGet, "/eth/v1/keystores", "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = _request(t, server, http.MethodGet, "/eth/v1/keystores", "bad", "")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// List.
+	status, res := _request(t, server, http.MethodGet, "/eth/v1/keystores", "secret", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"validating_pubkey": pubkey, "derivation_path": "m/12381/3600/0/0", "readonly": false},
+	}, res["data"])
+
+	// Create.
+	status, res = _request(t, server, http.MethodPost, "/eth/v1/mpc/accounts", "secret", `{"name":"Test 1","passphrase":"account passphrase"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, `account with name "Test 1" already exists`, res["message"])
+	status, res = _request(t, server, http.MethodPost, "/eth/v1/mpc/accounts", "secret", `{"name":"Test 2","passphrase":"account passphrase"}`)
+	require.Equal(t, http.StatusOK, status)
+	created := res["data"].(map[string]interface{})
+	assert.Regexp(t, `^m/12381/3600/[0-9]+/0$`, created["derivation_path"])
+	pubkey2 := created["validating_pubkey"].(string)
+	unlocked, err := wallet.(e2wtypes.WalletLocker).IsUnlocked(context.Background())
+	require.NoError(t, err)
+	assert.False(t, unlocked)
+
+	// Import.
+	status, res = _request(t, server, http.MethodPost, "/eth/v1/keystores", "secret", fmt.Sprintf(`{"keystores":["{\"pubkey\":\"%s\"}","{\"pubkey\":\"%096x\"}","bad"],"passwords":["","",""]}`, strings.TrimPrefix(pubkey, "0x"), 0))
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"status": "duplicate"},
+		map[string]interface{}{"status": "error", "message": "keystores cannot be imported into an MPC wallet"},
+		map[string]interface{}{"status": "error", "message": "invalid keystore"},
+	}, res["data"])
+	status, _ = _request(t, server, http.MethodPost, "/eth/v1/keystores", "secret", `{"keystores":["{}"],"passwords":[]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Remote keys.
+	status, res = _request(t, server, http.MethodGet, "/eth/v1/remotekeys", "secret", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.Len(t, res["data"], 2)
+	assert.Equal(t, "http://localhost:8000", res["data"].([]interface{})[0].(map[string]interface{})["url"])
+
+	// Delete.
+	status, res = _request(t, server, http.MethodDelete, "/eth/v1/keystores", "secret", fmt.Sprintf(`{"pubkeys":["%s","0x%096x"]}`, strings.ToUpper(pubkey2[2:]), 0))
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"status": "deleted"},
+		map[string]interface{}{"status": "not_found"},
+	}, res["data"])
+	// The wallet does not know the signing history of its accounts, so the interchange has no entries.
+	slashingProtection := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal([]byte(res["slashing_protection"].(string)), &slashingProtection))
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"interchange_format_version": "5",
+			"genesis_validators_root":    fmt.Sprintf("%#x", genesisValidatorsRoot),
+		},
+		"data": []interface{}{},
+	}, slashingProtection)
+
+	status, res = _request(t, server, http.MethodGet, "/eth/v1/keystores", "secret", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.Len(t, res["data"], 1)
+}
@@ -15,21 +15,33 @@ package mpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/pkg/errors"
 	e2types "github.com/wealdtech/go-eth2-types/v2"
 )
 
+const (
+	// keyServiceProtocolMPC is the protocol of the original MPC key service.
+	keyServiceProtocolMPC = "mpc"
+	// keyServiceProtocolWeb3Signer is the Web3Signer HTTP API protocol.
+	keyServiceProtocolWeb3Signer = "web3signer"
+)
+
 type keyService struct {
 	url       *url.URL
 	publicKey e2types.PublicKey
 	version   uint
+	protocol  string
+	// client is the HTTP client for requests; if nil the default client is used.
+	client *http.Client
 }
 
 type signRequest struct {
@@ -46,6 +58,9 @@ func (ks *keyService) MarshalJSON() ([]byte, error) {
 	data["pubkey"] = fmt.Sprintf("%x", ks.publicKey.Marshal())
 	data["url"] = ks.url.String()
 	data["version"] = ks.version
+	if ks.protocol != keyServiceProtocolMPC {
+		data["protocol"] = ks.protocol
+	}
 	return json.Marshal(data)
 }
 
@@ -93,12 +108,28 @@ func (ks *keyService) UnmarshalJSON(data []byte) error {
 	} else {
 		return errors.New("keyService version missing")
 	}
+	if val, exists := v["protocol"]; exists {
+		protocol, ok := val.(string)
+		if !ok {
+			return errors.New("keyService protocol invalid")
+		}
+		switch protocol {
+		case keyServiceProtocolMPC, keyServiceProtocolWeb3Signer:
+			ks.protocol = protocol
+		default:
+			return fmt.Errorf("keyService protocol %q not supported", protocol)
+		}
+	} else {
+		ks.protocol = keyServiceProtocolMPC
+	}
 
 	return nil
 }
 
 func newKeyService() *keyService {
-	return &keyService{}
+	return &keyService{
+		protocol: keyServiceProtocolMPC,
+	}
 }
 
 // PublicKey returns the remote public key
@@ -112,7 +143,15 @@ func (ks *keyService) PrivateKey() (e2types.PrivateKey, error) {
 }
 
 // Sign signs the payload using the remote signing service
-func (ks *keyService) Sign(payload []byte) (e2types.Signature, error) {
+func (ks *keyService) Sign(ctx context.Context, payload []byte) (e2types.Signature, error) {
+	if ks.protocol == keyServiceProtocolWeb3Signer {
+		return ks.signWeb3Signer(ctx, payload)
+	}
+	return ks.signMPC(ctx, payload)
+}
+
+// signMPC signs the payload using the MPC key service protocol.
+func (ks *keyService) signMPC(ctx context.Context, payload []byte) (e2types.Signature, error) {
 	r := &signRequest{
 		Payload: fmt.Sprintf("%x", payload),
 	}
@@ -128,40 +167,154 @@ func (ks *keyService) Sign(payload []byte) (e2types.Signature, error) {
 	}
 
 	endpoint := fmt.Sprintf("/%x", pubkey.Marshal())
-	url, err := ks.url.Parse(endpoint)
-	if err != nil {
+	return ks.sign(ctx, endpoint, data, parseMPCResponse)
+}
+
+// parseMPCResponse parses an MPC key service signing response.
+func parseMPCResponse(body []byte) (e2types.Signature, error) {
+	var v signResponse
+	if err := json.Unmarshal(body, &v); err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Post(url.String(), "application/json", bytes.NewBuffer(data))
+	if v.Signature == "" {
+		return nil, errors.New("missing signature")
+	}
+
+	bytes, err := hex.DecodeString(v.Signature)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	signature, err := e2types.BLSSignatureFromBytes(bytes)
 	if err != nil {
 		return nil, err
 	}
 
-	var v signResponse
-	if err := json.Unmarshal(body, &v); err != nil {
+	return signature, nil
+}
+
+// signWeb3Signer signs the payload using the Web3Signer HTTP API.
+// Web3Signer requires the type of the request and, for most types, the fork information and object being
+// signed; these are obtained from the context as supplied by WithWeb3SignerRequest().
+func (ks *keyService) signWeb3Signer(ctx context.Context, payload []byte) (e2types.Signature, error) {
+	if err := ks.checkRequest(ctx); err != nil {
+		return nil, err
+	}
+	request := ctx.Value(web3SignerRequestKey{}).(*Web3SignerRequest)
+	body := make(map[string]interface{})
+	for k, v := range request.Fields {
+		body[k] = v
+	}
+	body["type"] = request.Type
+	if len(request.ForkInfo) > 0 {
+		body["fork_info"] = request.ForkInfo
+	}
+	body["signingRoot"] = fmt.Sprintf("%#x", payload)
+	data, err := json.Marshal(body)
+	if err != nil {
 		return nil, err
 	}
 
-	if v.Signature == "" {
+	endpoint := fmt.Sprintf("/api/v1/eth2/sign/%#x", ks.publicKey.Marshal())
+	return ks.sign(ctx, endpoint, data, parseWeb3SignerResponse)
+}
+
+// checkRequest checks that the key service can sign with the given context.
+// Key services that use the Web3Signer protocol require the details of the request, as supplied by
+// WithWeb3SignerRequest().
+func (ks *keyService) checkRequest(ctx context.Context) error {
+	if ks.protocol != keyServiceProtocolWeb3Signer {
+		return nil
+	}
+	request, ok := ctx.Value(web3SignerRequestKey{}).(*Web3SignerRequest)
+	if !ok || request == nil || request.Type == "" {
+		return newError(ErrUnsupportedRequest, "web3signer request type missing")
+	}
+	return nil
+}
+
+// parseWeb3SignerResponse parses a Web3Signer signing response.
+// Web3Signer returns either a JSON object or a plain hex string, depending on the content type negotiated.
+func parseWeb3SignerResponse(body []byte) (e2types.Signature, error) {
+	signatureStr := strings.TrimSpace(string(body))
+	if strings.HasPrefix(signatureStr, "{") {
+		var v struct {
+			Signature string `json:"signature"`
+		}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, err
+		}
+		signatureStr = v.Signature
+	}
+	if signatureStr == "" {
 		return nil, errors.New("missing signature")
 	}
 
-	bytes, err := hex.DecodeString(v.Signature)
+	bytes, err := hex.DecodeString(strings.TrimPrefix(signatureStr, "0x"))
 	if err != nil {
 		return nil, err
 	}
 
-	signature, err := e2types.BLSSignatureFromBytes(bytes)
+	return e2types.BLSSignatureFromBytes(bytes)
+}
+
+// sign sends a signing request to an endpoint of the key service, parsing the response with the supplied function.
+// Failures to reach the key service or to obtain a signature from it are returned as a KeyServiceError.
+func (ks *keyService) sign(ctx context.Context, endpoint string, data []byte, parse func([]byte) (e2types.Signature, error)) (e2types.Signature, error) {
+	url, body, err := ks.request(ctx, http.MethodPost, endpoint, data)
 	if err != nil {
 		return nil, err
 	}
 
+	signature, err := parse(body)
+	if err != nil {
+		return nil, &KeyServiceError{URL: url, StatusCode: http.StatusOK, Err: err}
+	}
+
 	return signature, nil
 }
+
+// request sends a request to an endpoint of the key service, returning the URL of the request and the body of the
+// response.
+// Failures to reach the key service or unsuccessful responses are returned as a KeyServiceError.
+func (ks *keyService) request(ctx context.Context, method string, endpoint string, data []byte) (string, []byte, error) {
+	url, err := ks.url.Parse(endpoint)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url.String(), bytes.NewBuffer(data))
+	if err != nil {
+		return "", nil, err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if ks.protocol == keyServiceProtocolWeb3Signer {
+		req.Header.Set("Accept", "application/json")
+	}
+	client := ks.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, &KeyServiceError{URL: url.String(), Err: err}
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, &KeyServiceError{URL: url.String(), Err: err}
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", nil, &KeyServiceError{
+			URL:        url.String(),
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("%s returned status %d: %s", ks.protocol, resp.StatusCode, strings.TrimSpace(string(body))),
+		}
+	}
+
+	return url.String(), body, nil
+}
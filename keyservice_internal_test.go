@@ -14,6 +14,7 @@
 package mpc
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -50,6 +51,7 @@ func TestNewKeyService(t *testing.T) {
 		version   uint
 		url       string
 		publicKey []byte
+		protocol  string
 	}{
 		{
 			name: "Nil",
@@ -78,7 +80,7 @@ func TestNewKeyService(t *testing.T) {
 		{
 			name:  "BadURL",
 			input: []byte(`{"url": "%bad%"}`),
-			err:   errors.New(`parse %bad%: invalid URL escape "%"`),
+			err:   errors.New(`parse "%bad%": invalid URL escape "%"`),
 		},
 		{
 			name:  "MissingPubKey",
@@ -106,6 +108,25 @@ func TestNewKeyService(t *testing.T) {
 			url:       "http://localhost:8000",
 			version:   1,
 			publicKey: []byte{0xa9, 0x9a, 0x76, 0xed, 0x77, 0x96, 0xf7, 0xbe, 0x22, 0xd5, 0xb7, 0xe8, 0x5d, 0xee, 0xb7, 0xc5, 0x67, 0x7e, 0x88, 0xe5, 0x11, 0xe0, 0xb3, 0x37, 0x61, 0x8f, 0x8c, 0x4e, 0xb6, 0x13, 0x49, 0xb4, 0xbf, 0x2d, 0x15, 0x3f, 0x64, 0x9f, 0x7b, 0x53, 0x35, 0x9f, 0xe8, 0xb9, 0x4a, 0x38, 0xe4, 0x4c},
+			protocol:  "mpc",
+		},
+		{
+			name:  "BadProtocol",
+			input: []byte(`{"url": "http://localhost:8000", "pubkey": "a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c", "version": 1, "protocol": 1}`),
+			err:   errors.New("keyService protocol invalid"),
+		},
+		{
+			name:  "UnsupportedProtocol",
+			input: []byte(`{"url": "http://localhost:8000", "pubkey": "a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c", "version": 1, "protocol": "other"}`),
+			err:   errors.New(`keyService protocol "other" not supported`),
+		},
+		{
+			name:      "GoodWeb3Signer",
+			input:     []byte(`{"url": "http://localhost:9000", "pubkey": "a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c", "version": 1, "protocol": "web3signer"}`),
+			url:       "http://localhost:9000",
+			version:   1,
+			publicKey: []byte{0xa9, 0x9a, 0x76, 0xed, 0x77, 0x96, 0xf7, 0xbe, 0x22, 0xd5, 0xb7, 0xe8, 0x5d, 0xee, 0xb7, 0xc5, 0x67, 0x7e, 0x88, 0xe5, 0x11, 0xe0, 0xb3, 0x37, 0x61, 0x8f, 0x8c, 0x4e, 0xb6, 0x13, 0x49, 0xb4, 0xbf, 0x2d, 0x15, 0x3f, 0x64, 0x9f, 0x7b, 0x53, 0x35, 0x9f, 0xe8, 0xb9, 0x4a, 0x38, 0xe4, 0x4c},
+			protocol:  "web3signer",
 		},
 	}
 
@@ -122,6 +143,7 @@ func TestNewKeyService(t *testing.T) {
 				assert.Equal(t, test.url, output.url.String())
 				assert.Equal(t, test.version, output.version)
 				assert.Equal(t, test.publicKey, output.publicKey.Marshal())
+				assert.Equal(t, test.protocol, output.protocol)
 			}
 		})
 	}
@@ -190,7 +212,7 @@ func TestSign(t *testing.T) {
 			pubKey, err := ks.PublicKey()
 			require.NoError(t, err)
 
-			output, err := ks.Sign(test.payload)
+			output, err := ks.Sign(context.Background(), test.payload)
 			require.NoError(t, err)
 
 			if test.err != nil {
@@ -204,3 +226,89 @@ func TestSign(t *testing.T) {
 		})
 	}
 }
+
+func TestSignWeb3Signer(t *testing.T) {
+	privateKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	payload, err := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	require.NoError(t, err)
+	signature := privateKey.Sign(payload)
+
+	// Start a stub Web3Signer server; the response format is selected by the request type.
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, fmt.Sprintf("/api/v1/eth2/sign/%#x", privateKey.PublicKey().Marshal()), req.URL.Path)
+
+		var request map[string]json.RawMessage
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		assert.Equal(t, fmt.Sprintf(`"%#x"`, payload), string(request["signingRoot"]))
+		assert.JSONEq(t, `{"genesis_validators_root":"0x00"}`, string(request["fork_info"]))
+		assert.JSONEq(t, `{"slot":"1"}`, string(request["attestation"]))
+
+		switch string(request["type"]) {
+		case `"JSON"`:
+			rw.Write([]byte(fmt.Sprintf(`{"signature":"%#x"}`, signature.Marshal())))
+		case `"TEXT"`:
+			rw.Write([]byte(fmt.Sprintf("%#x\n", signature.Marshal())))
+		case `"EMPTY"`:
+			rw.Write([]byte(`{}`))
+		default:
+			http.Error(rw, "unsupported type", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		requestType string
+		err         string
+	}{
+		{
+			name: "TypeMissing",
+			err:  "web3signer request type missing",
+		},
+		{
+			name:        "JSON",
+			requestType: "JSON",
+		},
+		{
+			name:        "Text",
+			requestType: "TEXT",
+		},
+		{
+			name:        "SignatureMissing",
+			requestType: "EMPTY",
+			err:         "missing signature",
+		},
+		{
+			name:        "Rejected",
+			requestType: "BAD",
+			err:         "web3signer returned status 400: unsupported type",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ks := newKeyService()
+			require.NoError(t, json.Unmarshal([]byte(fmt.Sprintf(`{"url": "%s", "pubkey": "%x", "version": 1, "protocol": "web3signer"}`, server.URL, privateKey.PublicKey().Marshal())), ks))
+
+			ctx := context.Background()
+			if test.requestType != "" {
+				ctx = WithWeb3SignerRequest(ctx, &Web3SignerRequest{
+					Type:     test.requestType,
+					ForkInfo: json.RawMessage(`{"genesis_validators_root":"0x00"}`),
+					Fields: map[string]json.RawMessage{
+						"attestation": json.RawMessage(`{"slot":"1"}`),
+					},
+				})
+			}
+			output, err := ks.Sign(ctx, payload)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, signature.Marshal(), output.Marshal())
+			}
+		})
+	}
+}
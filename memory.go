@@ -0,0 +1,81 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// zeroize overwrites secret material, so that it does not remain in memory once it is no longer required.
+func zeroize(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+	// Ensure that the writes are not optimised away.
+	runtime.KeepAlive(data)
+}
+
+// SetMemoryLocking sets whether the seed is locked in memory whilst the wallet is unlocked, so that it cannot be
+// swapped to disk.  This is only supported on Linux, and is subject to the limit on locked memory for the process.
+// The keys of unlocked accounts are held by the BLS library, so are not locked in memory.
+// Memory locking is not stored with the wallet, so only applies to this instance.
+func (w *wallet) SetMemoryLocking(enabled bool) error {
+	if enabled && !memoryLockingSupported {
+		return errors.New("memory locking is not supported on this platform")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.seed != nil && enabled != w.memoryLocking {
+		if enabled {
+			if err := lockMemory(w.seed); err != nil {
+				return errors.Wrap(err, "failed to lock seed in memory")
+			}
+		} else if err := unlockMemory(w.seed); err != nil {
+			return errors.Wrap(err, "failed to unlock seed in memory")
+		}
+	}
+	w.memoryLocking = enabled
+	return nil
+}
+
+// setSeed replaces the seed of an unlocked wallet, clearing any previous seed.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) setSeed(seed []byte) error {
+	if w.memoryLocking {
+		if err := lockMemory(seed); err != nil {
+			zeroize(seed)
+			return errors.Wrap(err, "failed to lock seed in memory")
+		}
+	}
+	w.clearSeed()
+	w.seed = seed
+	return nil
+}
+
+// clearSeed clears the seed, locking the wallet.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) clearSeed() {
+	if w.seed == nil {
+		return
+	}
+	zeroize(w.seed)
+	if w.memoryLocking {
+		// Nothing can be done if this fails, and the seed has already been cleared.
+		_ = unlockMemory(w.seed)
+	}
+	w.seed = nil
+}
@@ -0,0 +1,151 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"encoding/hex"
+	"runtime"
+	"testing"
+
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// recordingEncryptor is a keystore encryptor that records the secrets passed to and returned from it.
+type recordingEncryptor struct {
+	e2wtypes.Encryptor
+	encrypted [][]byte
+	decrypted [][]byte
+}
+
+func (e *recordingEncryptor) Encrypt(data []byte, passphrase string) (map[string]interface{}, error) {
+	e.encrypted = append(e.encrypted, data)
+	return e.Encryptor.Encrypt(data, passphrase)
+}
+
+func (e *recordingEncryptor) Decrypt(data map[string]interface{}, passphrase string) ([]byte, error) {
+	decrypted, err := e.Encryptor.Decrypt(data, passphrase)
+	if err == nil {
+		e.decrypted = append(e.decrypted, decrypted)
+	}
+	return decrypted, err
+}
+
+// _assertZeroized is a helper to assert that buffers have been cleared.
+func _assertZeroized(t *testing.T, buffers [][]byte) {
+	require.NotEmpty(t, buffers)
+	for _, buffer := range buffers {
+		require.NotEmpty(t, buffer)
+		assert.Equal(t, make([]byte, len(buffer)), buffer)
+	}
+}
+
+// _memoryWallet is a helper to create a wallet using a recording encryptor.
+func _memoryWallet(t *testing.T) (*wallet, *recordingEncryptor) {
+	seed := make([]byte, 64)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	pubkey, err := hex.DecodeString("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	require.NoError(t, err)
+	encryptor := &recordingEncryptor{Encryptor: keystorev4.New()}
+	w, err := CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), scratch.New(), encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	// The supplied seed is not cleared.
+	assert.Equal(t, byte(1), seed[1])
+	_assertZeroized(t, encryptor.decrypted)
+	encryptor.encrypted = nil
+	encryptor.decrypted = nil
+	return w.(*wallet), encryptor
+}
+
+func TestZeroize(t *testing.T) {
+	zeroize(nil)
+	data := []byte{0x01, 0x02, 0x03}
+	zeroize(data)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00}, data)
+}
+
+func TestWalletLockZeroizesSeed(t *testing.T) {
+	w, encryptor := _memoryWallet(t)
+
+	require.NoError(t, w.Unlock(context.Background(), []byte("wallet passphrase")))
+	seed := w.seed
+	require.Len(t, seed, 64)
+	assert.NotEqual(t, make([]byte, 64), seed)
+
+	// Unlocking again replaces and clears the previous seed.
+	require.NoError(t, w.Unlock(context.Background(), []byte("wallet passphrase")))
+	assert.Equal(t, make([]byte, 64), seed)
+	seed = w.seed
+	require.NoError(t, w.Lock(context.Background()))
+	assert.Nil(t, w.seed)
+	assert.Equal(t, make([]byte, 64), seed)
+	_assertZeroized(t, encryptor.decrypted)
+
+	// The decrypted seed is cleared when the passphrase is changed.
+	encryptor.decrypted = nil
+	require.NoError(t, w.ChangePassphrase(context.Background(), []byte("wallet passphrase"), []byte("new passphrase")))
+	_assertZeroized(t, encryptor.decrypted)
+}
+
+func TestAccountZeroizesSecrets(t *testing.T) {
+	w, encryptor := _memoryWallet(t)
+	require.NoError(t, w.Unlock(context.Background(), []byte("wallet passphrase")))
+	encryptor.decrypted = nil
+
+	// The marshalled private key is cleared once encrypted.
+	acc, err := w.CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	_assertZeroized(t, encryptor.encrypted)
+	encryptor.encrypted = nil
+	_, err = w.AccountByName(context.Background(), "m/12381/3600/1/0")
+	require.NoError(t, err)
+	_assertZeroized(t, encryptor.encrypted)
+
+	// The decrypted private key is cleared once unlocked.
+	a := acc.(*account)
+	require.NoError(t, a.Unlock(context.Background(), []byte("account passphrase")))
+	_assertZeroized(t, encryptor.decrypted)
+	encryptor.decrypted = nil
+
+	// The decrypted private key is cleared when the passphrase is changed, including that decrypted for checking.
+	require.NoError(t, a.ChangePassphrase(context.Background(), []byte("account passphrase"), []byte("new passphrase")))
+	require.Len(t, encryptor.decrypted, 2)
+	_assertZeroized(t, encryptor.decrypted)
+}
+
+func TestMemoryLocking(t *testing.T) {
+	w, _ := _memoryWallet(t)
+	if runtime.GOOS != "linux" {
+		assert.EqualError(t, w.SetMemoryLocking(true), "memory locking is not supported on this platform")
+		return
+	}
+
+	require.NoError(t, w.SetMemoryLocking(true))
+	require.NoError(t, w.Unlock(context.Background(), []byte("wallet passphrase")))
+	seed := w.seed
+	require.NoError(t, w.Lock(context.Background()))
+	assert.Equal(t, make([]byte, 64), seed)
+
+	// Memory locking can be changed whilst unlocked.
+	require.NoError(t, w.Unlock(context.Background(), []byte("wallet passphrase")))
+	require.NoError(t, w.SetMemoryLocking(false))
+	require.NoError(t, w.SetMemoryLocking(true))
+	require.NoError(t, w.Lock(context.Background()))
+}
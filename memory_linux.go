@@ -0,0 +1,37 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"syscall"
+)
+
+// memoryLockingSupported is true as secrets can be locked in memory on Linux.
+const memoryLockingSupported = true
+
+// lockMemory locks the memory holding the data, so that it cannot be swapped to disk.
+func lockMemory(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return syscall.Mlock(data)
+}
+
+// unlockMemory unlocks memory locked by lockMemory.
+func unlockMemory(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return syscall.Munlock(data)
+}
@@ -0,0 +1,169 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	bip39 "github.com/tyler-smith/go-bip39"
+	util "github.com/wealdtech/go-eth2-util"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// mnemonicEntropyBits is the number of bits of entropy in generated mnemonics, giving 24 words.
+const mnemonicEntropyBits = 256
+
+// seedFromMnemonic calculates the seed for a BIP-39 mnemonic and optional passphrase.
+func seedFromMnemonic(mnemonic string, mnemonicPassphrase string) ([]byte, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, mnemonicPassphrase)
+	if err != nil {
+		return nil, errors.New("mnemonic invalid")
+	}
+	return seed, nil
+}
+
+// WithMnemonic sets the seed of the wallet from a BIP-39 mnemonic and optional passphrase.
+// This can be used in place of WithSeed().
+func WithMnemonic(mnemonic string, mnemonicPassphrase string) Option {
+	return optionFunc(func(o *options) error {
+		seed, err := seedFromMnemonic(mnemonic, mnemonicPassphrase)
+		if err != nil {
+			return &OptionError{Option: "WithMnemonic", Err: err}
+		}
+		o.seed = seed
+		o.seedGenerated = true
+		return nil
+	})
+}
+
+// WithUnverifiedRecovery allows RecoverWallet() to store the recovered seed even if the wallet has no accounts
+// against which the mnemonic can be checked.  Without this option such a recovery fails, as any mnemonic would be
+// accepted and replace the wallet's seed.
+func WithUnverifiedRecovery() Option {
+	return optionFunc(func(o *options) error {
+		o.unverifiedRecovery = true
+		return nil
+	})
+}
+
+// CreateWalletWithMnemonic creates a wallet with the given name, with a seed generated from a new BIP-39 mnemonic
+// and optional passphrase.  The mnemonic is returned along with the wallet; it is not stored and cannot be obtained
+// again, so should be recorded safely to allow the wallet to be recovered with RecoverWallet().
+// The WithKeyService() option is required; seed options cannot be supplied.
+func CreateWalletWithMnemonic(ctx context.Context, name string, passphrase []byte, store e2wtypes.Store, encryptor e2wtypes.Encryptor, mnemonicPassphrase string, opts ...Option) (e2wtypes.Wallet, string, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt.apply(o); err != nil {
+			return nil, "", err
+		}
+	}
+	if o.seed != nil {
+		return nil, "", errors.New("seed cannot be supplied when generating a mnemonic")
+	}
+
+	entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to generate entropy")
+	}
+	defer zeroize(entropy)
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to generate mnemonic")
+	}
+
+	wallet, err := CreateWalletWithOptions(ctx, name, passphrase, store, encryptor, append(opts, WithMnemonic(mnemonic, mnemonicPassphrase))...)
+	if err != nil {
+		return nil, "", err
+	}
+	return wallet, mnemonic, nil
+}
+
+// RecoverWallet recovers the seed of an existing wallet from its BIP-39 mnemonic and optional passphrase, for
+// example if the wallet's passphrase has been lost.
+// The keys derived from the recovered seed are checked against the public keys of all accounts stored in the
+// wallet, and the recovery fails if any do not match.  The recovery also fails if no account could be checked,
+// unless the WithUnverifiedRecovery() option is supplied.  On success the seed is stored encrypted with the supplied
+// passphrase, and the local share of each checked account is rebuilt from the seed and stored encrypted with
+// accountPassphrase, which replaces the account's own passphrase; other details of the accounts, such as whether they
+// are archived, are unchanged.  The seed and shares are each decrypted to confirm that they can be recovered before
+// anything is stored.  Accounts that cannot be decoded are not altered.
+// Options are as for OpenWallet(), along with WithUnverifiedRecovery().
+func RecoverWallet(ctx context.Context, name string, passphrase []byte, accountPassphrase []byte, store e2wtypes.Store, encryptor e2wtypes.Encryptor, mnemonic string, mnemonicPassphrase string, opts ...Option) (e2wtypes.Wallet, error) {
+	o, err := openOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := seedFromMnemonic(mnemonic, mnemonicPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize(seed)
+
+	wlt, err := openWallet(ctx, name, store, encryptor, o)
+	if err != nil {
+		return nil, err
+	}
+	w := wlt.(*wallet)
+
+	accounts := w.scanAccounts()
+	secrets := make([][]byte, len(accounts))
+	defer func() {
+		for _, secret := range secrets {
+			zeroize(secret)
+		}
+	}()
+	for i, a := range accounts {
+		privateKey, err := util.PrivateKeyFromSeedAndPath(seed, a.path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to derive key for account %q", a.name)
+		}
+		if !bytes.Equal(privateKey.PublicKey().Marshal(), a.publicKey.Marshal()) {
+			return nil, fmt.Errorf("mnemonic does not match account %q", a.name)
+		}
+		secrets[i] = privateKey.Marshal()
+	}
+	if len(accounts) == 0 && !o.unverifiedRecovery {
+		return nil, fmt.Errorf("wallet %q has no accounts against which to verify the mnemonic", name)
+	}
+
+	crypto, err := reencrypt(encryptor, seed, passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt seed")
+	}
+	for i, a := range accounts {
+		if a.crypto, err = reencrypt(encryptor, secrets[i], accountPassphrase); err != nil {
+			return nil, errors.Wrapf(err, "failed to encrypt key for account %q", a.name)
+		}
+		a.encryptor = encryptor
+		a.version = encryptor.Version()
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, a := range accounts {
+		if err := a.storeAccount(); err != nil {
+			return nil, errors.Wrapf(err, "failed to store recovered account %q", a.name)
+		}
+	}
+	w.crypto = crypto
+	w.seedEncryptor = encryptor
+	w.clearSeed()
+	if err := w.storeWallet(); err != nil {
+		return nil, errors.Wrap(err, "failed to store recovered wallet")
+	}
+	return w, nil
+}
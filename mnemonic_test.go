@@ -0,0 +1,237 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+func TestCreateWalletWithMnemonic(t *testing.T) {
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+	seed := make([]byte, 64)
+
+	_, _, err := mpc.CreateWalletWithMnemonic(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, "", mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed))
+	require.EqualError(t, err, "seed cannot be supplied when generating a mnemonic")
+
+	wallet, mnemonic, err := mpc.CreateWalletWithMnemonic(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, "mnemonic passphrase", mpc.WithKeyService("http://localhost:8000", pubkey))
+	require.NoError(t, err)
+	assert.Len(t, strings.Fields(mnemonic), 24)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "test account", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	// A wallet created from the same mnemonic derives the same keys.
+	otherStore := scratch.New()
+	other, err := mpc.CreateWalletWithOptions(context.Background(), "test wallet", []byte("wallet passphrase"), otherStore, encryptor, mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithMnemonic(mnemonic, "mnemonic passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, other.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	otherAccount, err := other.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "test account", []byte("account passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, account.PublicKey().Marshal(), otherAccount.PublicKey().Marshal())
+
+	_, err = mpc.CreateWalletWithOptions(context.Background(), "bad wallet", []byte("wallet passphrase"), store, encryptor, mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithMnemonic("bad mnemonic", ""))
+	require.EqualError(t, err, "invalid option WithMnemonic: mnemonic invalid")
+}
+
+func TestRecoverWallet(t *testing.T) {
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+
+	wallet, mnemonic, err := mpc.CreateWalletWithMnemonic(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, "mnemonic passphrase", mpc.WithKeyService("http://localhost:8000", pubkey))
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "test account", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	_, otherMnemonic, err := mpc.CreateWalletWithMnemonic(context.Background(), "other wallet", []byte("wallet passphrase"), scratch.New(), encryptor, "", mpc.WithKeyService("http://localhost:8000", pubkey))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name               string
+		walletName         string
+		mnemonic           string
+		mnemonicPassphrase string
+		err                string
+	}{
+		{
+			name:               "MnemonicInvalid",
+			walletName:         "test wallet",
+			mnemonic:           "bad mnemonic",
+			mnemonicPassphrase: "mnemonic passphrase",
+			err:                "mnemonic invalid",
+		},
+		{
+			name:               "WalletMissing",
+			walletName:         "missing wallet",
+			mnemonic:           mnemonic,
+			mnemonicPassphrase: "mnemonic passphrase",
+			err:                `wallet "missing wallet" does not exist: wallet not found`,
+		},
+		{
+			name:               "MnemonicIncorrect",
+			walletName:         "test wallet",
+			mnemonic:           otherMnemonic,
+			mnemonicPassphrase: "mnemonic passphrase",
+			err:                `mnemonic does not match account "test account"`,
+		},
+		{
+			name:               "MnemonicPassphraseIncorrect",
+			walletName:         "test wallet",
+			mnemonic:           mnemonic,
+			mnemonicPassphrase: "bad passphrase",
+			err:                `mnemonic does not match account "test account"`,
+		},
+		{
+			name:               "Good",
+			walletName:         "test wallet",
+			mnemonic:           mnemonic,
+			mnemonicPassphrase: "mnemonic passphrase",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := mpc.RecoverWallet(context.Background(), test.walletName, []byte("new passphrase"), []byte("new account passphrase"), store, encryptor, test.mnemonic, test.mnemonicPassphrase)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	// The recovered wallet is protected by the new passphrase.
+	recovered, err := mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	require.Error(t, recovered.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	require.NoError(t, recovered.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("new passphrase")))
+	_, err = recovered.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "second account", []byte("account passphrase"))
+	require.NoError(t, err)
+}
+
+func TestRecoverWalletUnverified(t *testing.T) {
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+
+	tests := []struct {
+		name     string
+		accounts [][]byte
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name:     "Undecodable",
+			accounts: [][]byte{[]byte("bad")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := scratch.New()
+			encryptor := keystorev4.New()
+			wallet, _, err := mpc.CreateWalletWithMnemonic(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, "", mpc.WithKeyService("http://localhost:8000", pubkey))
+			require.NoError(t, err)
+			for _, data := range test.accounts {
+				require.NoError(t, store.StoreAccount(wallet.ID(), uuid.New(), data))
+			}
+			_, otherMnemonic, err := mpc.CreateWalletWithMnemonic(context.Background(), "other wallet", []byte("wallet passphrase"), scratch.New(), encryptor, "", mpc.WithKeyService("http://localhost:8000", pubkey))
+			require.NoError(t, err)
+
+			// Without accounts to check against any mnemonic would pass, so the recovery is refused.
+			_, err = mpc.RecoverWallet(context.Background(), "test wallet", []byte("new passphrase"), []byte("new account passphrase"), store, encryptor, otherMnemonic, "")
+			require.EqualError(t, err, `wallet "test wallet" has no accounts against which to verify the mnemonic`)
+			wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+			require.NoError(t, err)
+			require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+
+			// The recovery can be explicitly allowed.
+			_, err = mpc.RecoverWallet(context.Background(), "test wallet", []byte("new passphrase"), []byte("new account passphrase"), store, encryptor, otherMnemonic, "", mpc.WithUnverifiedRecovery())
+			require.NoError(t, err)
+			wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+			require.NoError(t, err)
+			require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("new passphrase")))
+		})
+	}
+
+	// The option only applies to recovery.
+	_, err := mpc.OpenWallet(context.Background(), "test wallet", scratch.New(), keystorev4.New(), mpc.WithUnverifiedRecovery())
+	require.EqualError(t, err, "invalid option WithUnverifiedRecovery: only supported when recovering a wallet")
+}
+
+// lossyEncryptor is a keystore encryptor whose decryption does not return the data that was encrypted.
+type lossyEncryptor struct {
+	e2wtypes.Encryptor
+}
+
+func (e *lossyEncryptor) Decrypt(data map[string]interface{}, passphrase string) ([]byte, error) {
+	decrypted, err := e.Encryptor.Decrypt(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return decrypted[1:], nil
+}
+
+func TestRecoverWalletAccounts(t *testing.T) {
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+
+	wallet, mnemonic, err := mpc.CreateWalletWithMnemonic(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, "", mpc.WithKeyService("http://localhost:8000", pubkey))
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 1", []byte("account passphrase"))
+	require.NoError(t, err)
+	archived, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 2", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, wallet.(accountDeleter).ArchiveAccount(context.Background(), archived.ID()))
+
+	// Nothing is stored if the seed or shares cannot be recovered from their encryption.
+	_, err = mpc.RecoverWallet(context.Background(), "test wallet", []byte("new passphrase"), []byte("new account passphrase"), store, &lossyEncryptor{Encryptor: encryptor}, mnemonic, "")
+	require.EqualError(t, err, "failed to encrypt seed: decrypted data does not match")
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 1")
+	require.NoError(t, err)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	require.NoError(t, account.(e2wtypes.AccountLocker).Lock(context.Background()))
+
+	// The local shares of the accounts are rebuilt, protected by the new account passphrase.
+	_, err = mpc.RecoverWallet(context.Background(), "test wallet", []byte("new passphrase"), []byte("new account passphrase"), store, encryptor, mnemonic, "")
+	require.NoError(t, err)
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	account, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 1")
+	require.NoError(t, err)
+	require.Error(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("new account passphrase")))
+
+	// Other details of the accounts are unchanged.
+	archived, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 2")
+	require.NoError(t, err)
+	assert.True(t, archived.(interface{ IsArchived() bool }).IsArchived())
+}
@@ -0,0 +1,162 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	ssz "github.com/prysmaticlabs/go-ssz"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+)
+
+// domainBLSToExecutionChange is the domain for BLS to execution change messages.
+var domainBLSToExecutionChange = e2types.DomainType{0x0a, 0x00, 0x00, 0x00}
+
+// voluntaryExit is the SSZ representation of a voluntary exit.
+type voluntaryExit struct {
+	Epoch          uint64
+	ValidatorIndex uint64
+}
+
+// blsToExecutionChange is the SSZ representation of a BLS to execution change.
+type blsToExecutionChange struct {
+	ValidatorIndex     uint64
+	FromBLSPubkey      []byte `ssz-size:"48"`
+	ToExecutionAddress []byte `ssz-size:"20"`
+}
+
+// VoluntaryExit is a voluntary exit, in the format used by the beacon API.
+type VoluntaryExit struct {
+	Epoch          string `json:"epoch"`
+	ValidatorIndex string `json:"validator_index"`
+}
+
+// SignedVoluntaryExit is a signed voluntary exit, in the format used by the beacon API.
+type SignedVoluntaryExit struct {
+	Message   *VoluntaryExit `json:"message"`
+	Signature string         `json:"signature"`
+}
+
+// BLSToExecutionChange is a BLS to execution change, in the format used by the beacon API.
+type BLSToExecutionChange struct {
+	ValidatorIndex     string `json:"validator_index"`
+	FromBLSPubkey      string `json:"from_bls_pubkey"`
+	ToExecutionAddress string `json:"to_execution_address"`
+}
+
+// SignedBLSToExecutionChange is a signed BLS to execution change, in the format used by the beacon API.
+type SignedBLSToExecutionChange struct {
+	Message   *BLSToExecutionChange `json:"message"`
+	Signature string                `json:"signature"`
+}
+
+// SignVoluntaryExit signs a voluntary exit for the validator with the given index.
+// The fork version is that of the fork in which the exit is to be processed; from the Deneb fork onwards
+// this is the Capella fork version.
+// Exits are irreversible, so confirm must be true for the exit to be signed.
+// The account must be unlocked.
+func (a *account) SignVoluntaryExit(ctx context.Context, validatorIndex uint64, epoch uint64, forkVersion []byte, genesisValidatorsRoot []byte, confirm bool) (*SignedVoluntaryExit, error) {
+	if !confirm {
+		return nil, errors.New("voluntary exit not confirmed")
+	}
+	if len(forkVersion) != 4 {
+		return nil, errors.New("fork version must be 4 bytes")
+	}
+	if len(genesisValidatorsRoot) != 32 {
+		return nil, errors.New("genesis validators root must be 32 bytes")
+	}
+
+	objectRoot, err := ssz.HashTreeRoot(&voluntaryExit{
+		Epoch:          epoch,
+		ValidatorIndex: validatorIndex,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate voluntary exit root")
+	}
+
+	request, err := voluntaryExitRequest(validatorIndex, epoch, forkVersion, genesisValidatorsRoot)
+	if err != nil {
+		return nil, err
+	}
+	domain := e2types.Domain(e2types.DomainVoluntaryExit, forkVersion, genesisValidatorsRoot)
+	signature, err := a.signObjectRoot(ctx, objectRoot[:], domain, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign voluntary exit")
+	}
+
+	return &SignedVoluntaryExit{
+		Message: &VoluntaryExit{
+			Epoch:          fmt.Sprintf("%d", epoch),
+			ValidatorIndex: fmt.Sprintf("%d", validatorIndex),
+		},
+		Signature: fmt.Sprintf("%#x", signature.Marshal()),
+	}, nil
+}
+
+// SignBLSToExecutionChange signs a change of the withdrawal credentials for the validator with the given index
+// from the account's BLS public key to an execution address.
+// This should be called on the validator's withdrawal account.  The genesis fork version is used for the domain
+// regardless of the current fork, as per the specification.
+// Credential changes are irreversible, so confirm must be true for the change to be signed.
+// The Web3Signer protocol does not support BLS to execution changes, so accounts whose key service uses it return an
+// ErrUnsupportedRequest error.
+// The account must be unlocked.
+func (a *account) SignBLSToExecutionChange(ctx context.Context, validatorIndex uint64, toExecutionAddress []byte, genesisForkVersion []byte, genesisValidatorsRoot []byte, confirm bool) (*SignedBLSToExecutionChange, error) {
+	if !confirm {
+		return nil, errors.New("BLS to execution change not confirmed")
+	}
+	if !a.local && a.keyService.protocol == keyServiceProtocolWeb3Signer {
+		return nil, newError(ErrUnsupportedRequest, "web3signer key services cannot sign BLS to execution changes")
+	}
+	if len(toExecutionAddress) != 20 {
+		return nil, errors.New("execution address must be 20 bytes")
+	}
+	if len(genesisForkVersion) != 4 {
+		return nil, errors.New("genesis fork version must be 4 bytes")
+	}
+	if len(genesisValidatorsRoot) != 32 {
+		return nil, errors.New("genesis validators root must be 32 bytes")
+	}
+
+	publicKey := a.PublicKey()
+	if publicKey == nil {
+		return nil, errors.New("failed to obtain public key")
+	}
+	message := &blsToExecutionChange{
+		ValidatorIndex:     validatorIndex,
+		FromBLSPubkey:      publicKey.Marshal(),
+		ToExecutionAddress: toExecutionAddress,
+	}
+	objectRoot, err := ssz.HashTreeRoot(message)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate BLS to execution change root")
+	}
+
+	domain := e2types.Domain(domainBLSToExecutionChange, genesisForkVersion, genesisValidatorsRoot)
+	signature, err := a.signObjectRoot(ctx, objectRoot[:], domain, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign BLS to execution change")
+	}
+
+	return &SignedBLSToExecutionChange{
+		Message: &BLSToExecutionChange{
+			ValidatorIndex:     fmt.Sprintf("%d", validatorIndex),
+			FromBLSPubkey:      fmt.Sprintf("%#x", message.FromBLSPubkey),
+			ToExecutionAddress: fmt.Sprintf("%#x", message.ToExecutionAddress),
+		},
+		Signature: fmt.Sprintf("%#x", signature.Marshal()),
+	}, nil
+}
@@ -0,0 +1,141 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	ssz "github.com/prysmaticlabs/go-ssz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type operationsSigner interface {
+	SignVoluntaryExit(ctx context.Context, validatorIndex uint64, epoch uint64, forkVersion []byte, genesisValidatorsRoot []byte, confirm bool) (*mpc.SignedVoluntaryExit, error)
+	SignBLSToExecutionChange(ctx context.Context, validatorIndex uint64, toExecutionAddress []byte, genesisForkVersion []byte, genesisValidatorsRoot []byte, confirm bool) (*mpc.SignedBLSToExecutionChange, error)
+}
+
+// _signingRoot is a helper to calculate the signing root of an SSZ object.
+func _signingRoot(t *testing.T, object interface{}, domain []byte) []byte {
+	objectRoot, err := ssz.HashTreeRoot(object)
+	require.NoError(t, err)
+	root, err := ssz.HashTreeRoot(&struct {
+		ObjectRoot []byte `ssz-size:"32"`
+		Domain     []byte `ssz-size:"32"`
+	}{
+		ObjectRoot: objectRoot[:],
+		Domain:     domain,
+	})
+	require.NoError(t, err)
+	return root[:]
+}
+
+// _signature is a helper to decode a 0x-prefixed signature.
+func _signature(t *testing.T, input string) e2types.Signature {
+	signature, err := e2types.BLSSignatureFromBytes(_byteArray(strings.TrimPrefix(input, "0x")))
+	require.NoError(t, err)
+	return signature
+}
+
+func TestOperations(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, keyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+
+	forkVersion := _byteArray("03000000")
+	genesisForkVersion := _byteArray("00000000")
+	genesisValidatorsRoot := _byteArray("4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95")
+	executionAddress := _byteArray("000102030405060708090a0b0c0d0e0f10111213")
+
+	t.Run("ExitUnconfirmed", func(t *testing.T) {
+		_, err := account.(operationsSigner).SignVoluntaryExit(context.Background(), 1, 2, forkVersion, genesisValidatorsRoot, false)
+		require.EqualError(t, err, "voluntary exit not confirmed")
+	})
+
+	t.Run("ExitBadForkVersion", func(t *testing.T) {
+		_, err := account.(operationsSigner).SignVoluntaryExit(context.Background(), 1, 2, forkVersion[1:], genesisValidatorsRoot, true)
+		require.EqualError(t, err, "fork version must be 4 bytes")
+	})
+
+	t.Run("Exit", func(t *testing.T) {
+		exit, err := account.(operationsSigner).SignVoluntaryExit(context.Background(), 1, 2, forkVersion, genesisValidatorsRoot, true)
+		require.NoError(t, err)
+		data, err := json.Marshal(exit)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"message":{"epoch":"2","validator_index":"1"},"signature":"%s"}`, exit.Signature), string(data))
+
+		root := _signingRoot(t, &struct {
+			Epoch          uint64
+			ValidatorIndex uint64
+		}{
+			Epoch:          2,
+			ValidatorIndex: 1,
+		}, e2types.Domain(e2types.DomainVoluntaryExit, forkVersion, genesisValidatorsRoot))
+		assert.True(t, _signature(t, exit.Signature).Verify(root, account.PublicKey()))
+	})
+
+	t.Run("ChangeUnconfirmed", func(t *testing.T) {
+		_, err := account.(operationsSigner).SignBLSToExecutionChange(context.Background(), 1, executionAddress, genesisForkVersion, genesisValidatorsRoot, false)
+		require.EqualError(t, err, "BLS to execution change not confirmed")
+	})
+
+	t.Run("ChangeBadAddress", func(t *testing.T) {
+		_, err := account.(operationsSigner).SignBLSToExecutionChange(context.Background(), 1, executionAddress[1:], genesisForkVersion, genesisValidatorsRoot, true)
+		require.EqualError(t, err, "execution address must be 20 bytes")
+	})
+
+	t.Run("Change", func(t *testing.T) {
+		change, err := account.(operationsSigner).SignBLSToExecutionChange(context.Background(), 1, executionAddress, genesisForkVersion, genesisValidatorsRoot, true)
+		require.NoError(t, err)
+		data, err := json.Marshal(change)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"message":{"validator_index":"1","from_bls_pubkey":"%#x","to_execution_address":"0x000102030405060708090a0b0c0d0e0f10111213"},"signature":"%s"}`, account.PublicKey().Marshal(), change.Signature), string(data))
+
+		root := _signingRoot(t, &struct {
+			ValidatorIndex     uint64
+			FromBLSPubkey      []byte `ssz-size:"48"`
+			ToExecutionAddress []byte `ssz-size:"20"`
+		}{
+			ValidatorIndex:     1,
+			FromBLSPubkey:      account.PublicKey().Marshal(),
+			ToExecutionAddress: executionAddress,
+		}, e2types.Domain(e2types.DomainType{0x0a, 0x00, 0x00, 0x00}, genesisForkVersion, genesisValidatorsRoot))
+		assert.True(t, _signature(t, change.Signature).Verify(root, account.PublicKey()))
+	})
+}
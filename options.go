@@ -0,0 +1,260 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+)
+
+// Path templates for the keys defined by EIP-2334, for use with WithDerivationPath().
+const (
+	// SigningPathTemplate is the template for the paths of validator signing keys.
+	SigningPathTemplate = "m/12381/3600/%d/0"
+	// WithdrawalPathTemplate is the template for the paths of withdrawal keys.
+	WithdrawalPathTemplate = "m/12381/3600/%d"
+)
+
+// defaultPathTemplate is the template for the paths of accounts created by CreateAccount().
+const defaultPathTemplate = SigningPathTemplate
+
+// options are the options for the creation of a wallet.
+type options struct {
+	keyServiceURL       *url.URL
+	keyServicePublicKey e2types.PublicKey
+	keyServiceProtocol  string
+	httpClient          *http.Client
+	timeout             time.Duration
+	tlsConfig           *tls.Config
+	seed                []byte
+	// seedGenerated is true if the seed was generated from a mnemonic rather than supplied, so can be cleared once used.
+	seedGenerated bool
+	pathTemplate  string
+	// unverifiedRecovery allows RecoverWallet() to store a seed that could not be checked against any account.
+	unverifiedRecovery bool
+}
+
+// Option is an option for the creation of a wallet.
+type Option interface {
+	apply(*options) error
+}
+
+type optionFunc func(*options) error
+
+func (f optionFunc) apply(o *options) error {
+	return f(o)
+}
+
+// OptionError is returned when an option for the creation of a wallet is invalid.
+type OptionError struct {
+	// Option is the name of the invalid option, for example "WithSeed".
+	Option string
+	// Err is the reason the option is invalid.
+	Err error
+}
+
+// Error implements error.
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid option %s: %v", e.Option, e.Err)
+}
+
+// Unwrap returns the reason the option is invalid.
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// WithKeyService sets the URL of the key service and the public key of its share.  This option is required.
+func WithKeyService(keyServiceURL string, publicKey []byte) Option {
+	return optionFunc(func(o *options) error {
+		url, err := url.Parse(keyServiceURL)
+		if err != nil {
+			return &OptionError{Option: "WithKeyService", Err: err}
+		}
+		blsPubKey, err := e2types.BLSPublicKeyFromBytes(publicKey)
+		if err != nil {
+			return &OptionError{Option: "WithKeyService", Err: err}
+		}
+		o.keyServiceURL = url
+		o.keyServicePublicKey = blsPubKey
+		return nil
+	})
+}
+
+// WithKeyServiceProtocol sets the protocol of the key service, either "mpc" (the default) or "web3signer".
+func WithKeyServiceProtocol(protocol string) Option {
+	return optionFunc(func(o *options) error {
+		switch protocol {
+		case keyServiceProtocolMPC, keyServiceProtocolWeb3Signer:
+			o.keyServiceProtocol = protocol
+			return nil
+		default:
+			return &OptionError{Option: "WithKeyServiceProtocol", Err: fmt.Errorf("protocol %q not supported", protocol)}
+		}
+	})
+}
+
+// WithHTTPClient sets the HTTP client used to communicate with the key service.
+// The client is not stored with the wallet, so must also be supplied to OpenWallet() or DeserializeWallet().
+func WithHTTPClient(client *http.Client) Option {
+	return optionFunc(func(o *options) error {
+		if client == nil {
+			return &OptionError{Option: "WithHTTPClient", Err: errors.New("client missing")}
+		}
+		o.httpClient = client
+		return nil
+	})
+}
+
+// WithTimeout sets the timeout for requests to the key service.
+// The timeout is not stored with the wallet, so must also be supplied to OpenWallet() or DeserializeWallet().
+func WithTimeout(timeout time.Duration) Option {
+	return optionFunc(func(o *options) error {
+		if timeout <= 0 {
+			return &OptionError{Option: "WithTimeout", Err: errors.New("timeout must be greater than 0")}
+		}
+		o.timeout = timeout
+		return nil
+	})
+}
+
+// WithTLSConfig sets the TLS configuration for requests to the key service, for example to supply a client
+// certificate.  If used with WithHTTPClient() the client's transport must be an *http.Transport, which is copied
+// with this configuration.  The configuration is not stored with the wallet, so must also be supplied to
+// OpenWallet() or DeserializeWallet().
+func WithTLSConfig(config *tls.Config) Option {
+	return optionFunc(func(o *options) error {
+		if config == nil {
+			return &OptionError{Option: "WithTLSConfig", Err: errors.New("configuration missing")}
+		}
+		o.tlsConfig = config
+		return nil
+	})
+}
+
+// WithSeed sets the seed from which the wallet's local shares are derived.  This option is required.
+func WithSeed(seed []byte) Option {
+	return optionFunc(func(o *options) error {
+		if len(seed) != 64 {
+			return &OptionError{Option: "WithSeed", Err: errors.New("seed must be 64 bytes")}
+		}
+		o.seed = seed
+		return nil
+	})
+}
+
+// WithDerivationPath sets the template for the paths of accounts created with CreateAccount(), for example
+// SigningPathTemplate or WithdrawalPathTemplate.  The template must contain a single %d, which is replaced by the
+// account number, and must generate paths that follow EIP-2333 with indices that do not have leading zeros.
+func WithDerivationPath(template string) Option {
+	return optionFunc(func(o *options) error {
+		if err := validatePathTemplate(template); err != nil {
+			return &OptionError{Option: "WithDerivationPath", Err: err}
+		}
+		o.pathTemplate = template
+		return nil
+	})
+}
+
+// validatePathTemplate checks that a path template will generate valid paths.
+func validatePathTemplate(template string) error {
+	if strings.Count(template, "%") != 1 || strings.Count(template, "%d") != 1 {
+		return fmt.Errorf("path template %q must contain a single %%d", template)
+	}
+	if err := checkPath(fmt.Sprintf(template, 0)); err != nil {
+		return fmt.Errorf("path template %q %v", template, err)
+	}
+	return nil
+}
+
+// validatePath checks that a path follows the syntax of EIP-2333: m followed by one or more indices, each a
+// decimal number that fits in 32 bits.  Indices must not have leading zeros, so that each key has a single path.
+func validatePath(path string) error {
+	if err := checkPath(path); err != nil {
+		return fmt.Errorf("path %q %v", path, err)
+	}
+	return nil
+}
+
+// checkPath checks the syntax of a path, returning an error that describes the problem without naming the path.
+func checkPath(path string) error {
+	if !strings.HasPrefix(path, "m/") {
+		return errors.New("must start with m/")
+	}
+	for _, component := range strings.Split(path, "/")[1:] {
+		if _, err := strconv.ParseUint(component, 10, 32); err != nil || (len(component) > 1 && component[0] == '0') {
+			return fmt.Errorf("has invalid component %q", component)
+		}
+	}
+	return nil
+}
+
+// openOptions applies the options for opening an existing wallet.  Only the options that configure the HTTP
+// client, and WithUnverifiedRecovery() which the caller must check, apply, as the others are stored with the wallet.
+func openOptions(opts []Option) (*options, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt.apply(o); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case o.keyServiceURL != nil:
+		return nil, &OptionError{Option: "WithKeyService", Err: errors.New("not supported when opening a wallet")}
+	case o.keyServiceProtocol != "":
+		return nil, &OptionError{Option: "WithKeyServiceProtocol", Err: errors.New("not supported when opening a wallet")}
+	case o.seed != nil:
+		return nil, &OptionError{Option: "WithSeed", Err: errors.New("not supported when opening a wallet")}
+	case o.pathTemplate != "":
+		return nil, &OptionError{Option: "WithDerivationPath", Err: errors.New("not supported when opening a wallet")}
+	}
+	return o, nil
+}
+
+// client returns the HTTP client for the options, or nil if the default client should be used.
+func (o *options) client() (*http.Client, error) {
+	if o.httpClient == nil && o.tlsConfig == nil && o.timeout == 0 {
+		return nil, nil
+	}
+	client := &http.Client{}
+	if o.httpClient != nil {
+		// Copy the client so that the caller's client is not altered.
+		*client = *o.httpClient
+	}
+	if o.tlsConfig != nil {
+		var transport *http.Transport
+		switch clientTransport := client.Transport.(type) {
+		case nil:
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			// Copy the transport so that the caller's transport is not altered.
+			transport = clientTransport.Clone()
+		default:
+			return nil, &OptionError{Option: "WithTLSConfig", Err: errors.New("cannot apply to a client whose transport is not an *http.Transport")}
+		}
+		transport.TLSClientConfig = o.tlsConfig
+		client.Transport = transport
+	}
+	if o.timeout != 0 {
+		client.Timeout = o.timeout
+	}
+	return client, nil
+}
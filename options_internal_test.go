@@ -0,0 +1,48 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientTLSConfig(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "keyservice.example.com"}
+	callerTransport := &http.Transport{MaxIdleConns: 7}
+	callerClient := &http.Client{Transport: callerTransport}
+
+	o, err := openOptions([]Option{WithHTTPClient(callerClient), WithTLSConfig(tlsConfig), WithTimeout(time.Second)})
+	require.NoError(t, err)
+	client, err := o.client()
+	require.NoError(t, err)
+
+	// The caller's transport is copied with the TLS configuration, rather than replaced.
+	transport, isTransport := client.Transport.(*http.Transport)
+	require.True(t, isTransport)
+	assert.False(t, transport == callerTransport)
+	assert.Equal(t, 7, transport.MaxIdleConns)
+	assert.Equal(t, tlsConfig, transport.TLSClientConfig)
+	assert.Equal(t, time.Second, client.Timeout)
+
+	// The caller's client and transport are not altered.
+	assert.False(t, callerTransport.TLSClientConfig == tlsConfig)
+	assert.True(t, callerClient.Transport == callerTransport)
+	assert.Zero(t, callerClient.Timeout)
+}
@@ -0,0 +1,280 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+func TestCreateWalletWithOptions(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+
+	tests := []struct {
+		name   string
+		opts   []mpc.Option
+		option string
+		err    string
+	}{
+		{
+			name: "KeyServiceMissing",
+			opts: []mpc.Option{mpc.WithSeed(seed)},
+			err:  "key service required",
+		},
+		{
+			name: "SeedMissing",
+			opts: []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey)},
+			err:  "seed required",
+		},
+		{
+			name:   "BadKeyServiceURL",
+			opts:   []mpc.Option{mpc.WithKeyService("%bad%", pubkey), mpc.WithSeed(seed)},
+			option: "WithKeyService",
+		},
+		{
+			name:   "BadKeyServicePublicKey",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey[1:]), mpc.WithSeed(seed)},
+			option: "WithKeyService",
+			err:    "invalid option WithKeyService: public key must be 48 bytes",
+		},
+		{
+			name:   "BadSeed",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed[1:])},
+			option: "WithSeed",
+			err:    "invalid option WithSeed: seed must be 64 bytes",
+		},
+		{
+			name:   "BadProtocol",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithKeyServiceProtocol("bad")},
+			option: "WithKeyServiceProtocol",
+			err:    `invalid option WithKeyServiceProtocol: protocol "bad" not supported`,
+		},
+		{
+			name:   "HTTPClientMissing",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithHTTPClient(nil)},
+			option: "WithHTTPClient",
+			err:    "invalid option WithHTTPClient: client missing",
+		},
+		{
+			name:   "BadTimeout",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithTimeout(0)},
+			option: "WithTimeout",
+			err:    "invalid option WithTimeout: timeout must be greater than 0",
+		},
+		{
+			name:   "TLSConfigMissing",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithTLSConfig(nil)},
+			option: "WithTLSConfig",
+			err:    "invalid option WithTLSConfig: configuration missing",
+		},
+		{
+			name:   "DerivationPathNoPlaceholder",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithDerivationPath("m/12381/3600/0/0")},
+			option: "WithDerivationPath",
+			err:    `invalid option WithDerivationPath: path template "m/12381/3600/0/0" must contain a single %d`,
+		},
+		{
+			name:   "DerivationPathBadPrefix",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithDerivationPath("12381/3600/%d/0")},
+			option: "WithDerivationPath",
+			err:    `invalid option WithDerivationPath: path template "12381/3600/%d/0" must start with m/`,
+		},
+		{
+			name:   "DerivationPathBadComponent",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithDerivationPath("m/12381/x/%d")},
+			option: "WithDerivationPath",
+			err:    `invalid option WithDerivationPath: path template "m/12381/x/%d" has invalid component "x"`,
+		},
+		{
+			name:   "DerivationPathLeadingZero",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithDerivationPath("m/12381/03600/%d")},
+			option: "WithDerivationPath",
+			err:    `invalid option WithDerivationPath: path template "m/12381/03600/%d" has invalid component "03600"`,
+		},
+		{
+			name:   "DerivationPathOverflow",
+			opts:   []mpc.Option{mpc.WithKeyService("http://localhost:8000", pubkey), mpc.WithSeed(seed), mpc.WithDerivationPath("m/4294967296/%d")},
+			option: "WithDerivationPath",
+			err:    `invalid option WithDerivationPath: path template "m/4294967296/%d" has invalid component "4294967296"`,
+		},
+		{
+			name: "Good",
+			opts: []mpc.Option{
+				mpc.WithKeyService("http://localhost:8000", pubkey),
+				mpc.WithSeed(seed),
+				mpc.WithKeyServiceProtocol("web3signer"),
+				mpc.WithHTTPClient(&http.Client{}),
+				mpc.WithTimeout(5 * time.Second),
+				mpc.WithDerivationPath("m/12381/3600/0/%d"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := scratch.New()
+			encryptor := keystorev4.New()
+			_, err := mpc.CreateWalletWithOptions(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, test.opts...)
+			if test.option == "" && test.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+			}
+			var optionErr *mpc.OptionError
+			if test.option == "" {
+				assert.False(t, errors.As(err, &optionErr))
+			} else {
+				require.True(t, errors.As(err, &optionErr))
+				assert.Equal(t, test.option, optionErr.Option)
+			}
+		})
+	}
+}
+
+func TestDerivationPath(t *testing.T) {
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+	_, err := mpc.CreateWalletWithOptions(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor,
+		mpc.WithKeyService("http://localhost:8000", pubkey),
+		mpc.WithSeed(seed),
+		mpc.WithDerivationPath("m/12381/3600/0/%d"),
+	)
+	require.NoError(t, err)
+
+	// Ensure the template is persisted with the wallet.
+	wallet, err := mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "test account", []byte("account passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, "m/12381/3600/0/0", account.(e2wtypes.AccountPathProvider).Path())
+}
+
+func TestWithdrawalPathTemplate(t *testing.T) {
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+	wallet, err := mpc.CreateWalletWithOptions(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor,
+		mpc.WithKeyService("http://localhost:8000", pubkey),
+		mpc.WithSeed(seed),
+		mpc.WithDerivationPath(mpc.WithdrawalPathTemplate),
+	)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+
+	// An explicit path that the template would generate is skipped when allocating account numbers.
+	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/0", "Explicit", []byte("account passphrase"))
+	require.NoError(t, err)
+	for i, expected := range []string{"m/12381/3600/1", "m/12381/3600/2"} {
+		account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("Account %d", i), []byte("account passphrase"))
+		require.NoError(t, err)
+		assert.Equal(t, expected, account.(e2wtypes.AccountPathProvider).Path())
+	}
+}
+
+// countingTransport is an HTTP transport that counts the requests made through it.
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOpenWalletWithOptions(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWalletWithOptions(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor,
+		mpc.WithKeyService(keyService.URL, remoteKey.PublicKey().Marshal()),
+		mpc.WithSeed(seed),
+	)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	// Options stored with the wallet cannot be supplied when opening it.
+	_, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor, mpc.WithSeed(seed))
+	require.EqualError(t, err, "invalid option WithSeed: not supported when opening a wallet")
+
+	// A TLS configuration cannot be applied to a client with a custom transport.
+	_, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor,
+		mpc.WithHTTPClient(&http.Client{Transport: &countingTransport{}}),
+		mpc.WithTLSConfig(&tls.Config{}),
+	)
+	var optionErr *mpc.OptionError
+	require.True(t, errors.As(err, &optionErr))
+	assert.Equal(t, "WithTLSConfig", optionErr.Option)
+
+	// The client supplied when opening the wallet is used to communicate with the key service.
+	transport := &countingTransport{}
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor,
+		mpc.WithHTTPClient(&http.Client{Transport: transport}),
+		mpc.WithTimeout(5*time.Second),
+	)
+	require.NoError(t, err)
+	account, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Test")
+	require.NoError(t, err)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+	_, err = account.(e2wtypes.AccountSigner).Sign(context.Background(), []byte("test"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, transport.requests)
+}
@@ -0,0 +1,186 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// PassphraseReport is the result of changing the passphrase of all accounts in a wallet.
+type PassphraseReport struct {
+	// Changed are the names of the accounts whose passphrases were changed.
+	Changed []string `json:"changed"`
+	// Skipped are the names of the accounts whose passphrases were not changed, with the reasons.
+	// Accounts that do not use the old passphrase are skipped.
+	Skipped map[string]string `json:"skipped"`
+}
+
+// ChangePassphrase changes the passphrase that protects the wallet's seed.
+// The seed is re-encrypted with the wallet's encryptor, and decrypted again to confirm that the new passphrase works
+// before it is stored.  The passphrases of accounts are unchanged.
+func (w *wallet) ChangePassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	seed, err := w.seedEncryptor.Decrypt(w.crypto, string(oldPassphrase))
+	if err != nil {
+		return newError(ErrIncorrectPassphrase, "incorrect passphrase")
+	}
+	defer zeroize(seed)
+	crypto, err := reencrypt(w.encryptor, seed, newPassphrase)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt seed")
+	}
+
+	oldCrypto, oldEncryptor := w.crypto, w.seedEncryptor
+	w.crypto = crypto
+	w.seedEncryptor = w.encryptor
+	if err := w.storeWallet(); err != nil {
+		w.crypto, w.seedEncryptor = oldCrypto, oldEncryptor
+		return errors.Wrap(err, "failed to store wallet")
+	}
+
+	return nil
+}
+
+// ChangeAccountsPassphrase changes the passphrase of all accounts in the wallet that use the old passphrase.
+// Accounts that use a different passphrase, are archived, or cannot be obtained, are skipped and listed in the report.
+// An error is returned if an account that uses the old passphrase cannot be stored, in which case the report lists
+// the accounts already changed.
+func (w *wallet) ChangeAccountsPassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) (*PassphraseReport, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	report := &PassphraseReport{
+		Changed: make([]string, 0),
+		Skipped: make(map[string]string),
+	}
+	entries, err := w.selectIndexEntries(&AccountsFilter{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read index")
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		acc, err := w.accountByID(ctx, entry.ID)
+		if err != nil {
+			report.Skipped[entry.Name] = err.Error()
+			continue
+		}
+		err = acc.(*account).changePassphrase(ctx, oldPassphrase, newPassphrase)
+		switch {
+		case errors.Is(err, ErrIncorrectPassphrase), errors.Is(err, ErrArchived):
+			report.Skipped[entry.Name] = err.Error()
+		case err != nil:
+			return report, errors.Wrapf(err, "failed to change passphrase for account %q", entry.Name)
+		default:
+			report.Changed = append(report.Changed, entry.Name)
+		}
+	}
+
+	return report, nil
+}
+
+// ChangePassphrase changes the passphrase that protects the account's local share.
+// The share is re-encrypted with the wallet's encryptor, and decrypted again to confirm that the new passphrase
+// works before it is stored.
+func (a *account) ChangePassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) error {
+	w := a.wallet.(*wallet)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return a.changePassphrase(ctx, oldPassphrase, newPassphrase)
+}
+
+// changePassphrase changes the passphrase of the account.
+// The account is re-read from the store and only its crypto is replaced, as this instance of the account might
+// predate changes such as its archival.  Deleted and archived accounts are refused.
+// This is an internal function, that assumes a lock is held on the account's wallet.
+func (a *account) changePassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.programmatic {
+		return errors.New("programmatic accounts are not stored, so their passphrase cannot be changed")
+	}
+	w := a.wallet.(*wallet)
+	if err := w.checkAccountRetired(a.id); err != nil {
+		return err
+	}
+	acc, err := w.accountByID(ctx, a.id)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve account")
+	}
+	stored := acc.(*account)
+	if stored.archived {
+		return newError(ErrArchived, "account is archived")
+	}
+
+	secretBytes, err := stored.encryptor.Decrypt(stored.crypto, string(oldPassphrase))
+	if err != nil {
+		return newError(ErrIncorrectPassphrase, "incorrect passphrase")
+	}
+	defer zeroize(secretBytes)
+	secretKey, err := e2types.BLSPrivateKeyFromBytes(secretBytes)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(secretKey.PublicKey().Marshal(), stored.publicKey.Marshal()) {
+		return newError(ErrCorruptData, "secret key does not correspond to public key")
+	}
+	crypto, err := reencrypt(w.encryptor, secretBytes, newPassphrase)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt secret key")
+	}
+
+	stored.crypto = crypto
+	stored.encryptor = w.encryptor
+	stored.version = w.encryptor.Version()
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if err := w.store.StoreAccount(w.id, a.id, data); err != nil {
+		return errors.Wrap(err, "failed to store account")
+	}
+	a.crypto = stored.crypto
+	a.encryptor = stored.encryptor
+	a.version = stored.version
+
+	return nil
+}
+
+// reencrypt encrypts a secret with a passphrase, and decrypts the result to confirm that it can be recovered.
+func reencrypt(encryptor e2wtypes.Encryptor, secret []byte, passphrase []byte) (map[string]interface{}, error) {
+	crypto, err := encryptor.Encrypt(secret, string(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := encryptor.Decrypt(crypto, string(passphrase))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt")
+	}
+	defer zeroize(decrypted)
+	if !bytes.Equal(decrypted, secret) {
+		return nil, errors.New("decrypted data does not match")
+	}
+	return crypto, nil
+}
@@ -0,0 +1,199 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type passphraseChanger interface {
+	ChangePassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) error
+}
+
+type accountsPassphraseChanger interface {
+	ChangeAccountsPassphrase(ctx context.Context, oldPassphrase []byte, newPassphrase []byte) (*mpc.PassphraseReport, error)
+}
+
+func TestChangeWalletPassphrase(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("old passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("old passphrase")))
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+
+	err = wallet.(passphraseChanger).ChangePassphrase(context.Background(), []byte("wrong passphrase"), []byte("new passphrase"))
+	assert.EqualError(t, err, "incorrect passphrase")
+	assert.True(t, errors.Is(err, mpc.ErrIncorrectPassphrase))
+
+	require.NoError(t, wallet.(passphraseChanger).ChangePassphrase(context.Background(), []byte("old passphrase"), []byte("new passphrase")))
+	assert.Error(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("old passphrase")))
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("new passphrase")))
+
+	// The change is persisted, and the seed is unchanged.
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	assert.Error(t, reopened.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("old passphrase")))
+	require.NoError(t, reopened.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("new passphrase")))
+	report, err := reopened.(walletVerifier).VerifyAndRepair(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, report.Verified, 1)
+	assert.Len(t, report.Mismatched, 0)
+}
+
+func TestChangeAccountPassphrase(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("old passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+
+	// The wallet does not need to be unlocked.
+	err = account.(passphraseChanger).ChangePassphrase(context.Background(), []byte("wrong passphrase"), []byte("new passphrase"))
+	assert.EqualError(t, err, "incorrect passphrase")
+	assert.True(t, errors.Is(err, mpc.ErrIncorrectPassphrase))
+	require.NoError(t, account.(passphraseChanger).ChangePassphrase(context.Background(), []byte("old passphrase"), []byte("new passphrase")))
+	assert.Error(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("old passphrase")))
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("new passphrase")))
+
+	// The change is persisted.
+	stored, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Test")
+	require.NoError(t, err)
+	assert.Error(t, stored.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("old passphrase")))
+	require.NoError(t, stored.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("new passphrase")))
+}
+
+func TestChangeAccountsPassphrase(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	for name, passphrase := range map[string]string{
+		"Account 1": "old passphrase",
+		"Account 2": "old passphrase",
+		"Account 3": "other passphrase",
+	} {
+		_, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), name, []byte(passphrase))
+		require.NoError(t, err)
+	}
+
+	report, err := wallet.(accountsPassphraseChanger).ChangeAccountsPassphrase(context.Background(), []byte("old passphrase"), []byte("new passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Account 1", "Account 2"}, report.Changed)
+	assert.Equal(t, map[string]string{"Account 3": "incorrect passphrase"}, report.Skipped)
+
+	for name, passphrase := range map[string]string{
+		"Account 1": "new passphrase",
+		"Account 2": "new passphrase",
+		"Account 3": "other passphrase",
+	} {
+		account, err := wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), name)
+		require.NoError(t, err)
+		require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte(passphrase)))
+	}
+}
+
+func TestChangeAccountPassphraseRetired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestChangeAccountPassphraseRetired")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := filesystem.New(dir)
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte{}, store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+	archivedAccount, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Archived", []byte("old passphrase"))
+	require.NoError(t, err)
+	deletedAccount, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Deleted", []byte("old passphrase"))
+	require.NoError(t, err)
+
+	// Retire the accounts through another instance of the wallet, so the instances of the accounts above are stale.
+	other, err := mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	require.NoError(t, other.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte{}))
+	require.NoError(t, other.(accountDeleter).ArchiveAccount(context.Background(), archivedAccount.ID()))
+	require.NoError(t, other.(accountDeleter).DeleteAccount(context.Background(), deletedAccount.ID()))
+
+	err = archivedAccount.(passphraseChanger).ChangePassphrase(context.Background(), []byte("old passphrase"), []byte("new passphrase"))
+	assert.EqualError(t, err, "account is archived")
+	assert.True(t, errors.Is(err, mpc.ErrArchived))
+	err = deletedAccount.(passphraseChanger).ChangePassphrase(context.Background(), []byte("old passphrase"), []byte("new passphrase"))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, mpc.ErrNotFound))
+
+	// The archived account remains archived, and the deleted account is not recreated.
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	archived, err := reopened.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), archivedAccount.ID())
+	require.NoError(t, err)
+	err = archived.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("old passphrase"))
+	assert.True(t, errors.Is(err, mpc.ErrArchived))
+	_, err = store.RetrieveAccount(reopened.ID(), deletedAccount.ID())
+	assert.Error(t, err)
+
+	// Accounts retired through the same instance of the wallet are refused.
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("old passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, wallet.(accountDeleter).DeleteAccount(context.Background(), account.ID()))
+	err = account.(passphraseChanger).ChangePassphrase(context.Background(), []byte("old passphrase"), []byte("new passphrase"))
+	assert.EqualError(t, err, `account "Test" has been deleted`)
+	_, err = store.RetrieveAccount(wallet.ID(), account.ID())
+	assert.Error(t, err)
+}
@@ -0,0 +1,369 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	indexer "github.com/wealdtech/go-indexer"
+)
+
+// pathIndex maps between account paths and IDs.
+type pathIndex struct {
+	paths map[uuid.UUID]string
+	ids   map[string]uuid.UUID
+}
+
+// newPathIndex creates a new path index.
+func newPathIndex() *pathIndex {
+	return &pathIndex{
+		paths: make(map[uuid.UUID]string),
+		ids:   make(map[string]uuid.UUID),
+	}
+}
+
+// Add adds an entry to the index.
+func (p *pathIndex) Add(id uuid.UUID, path string) {
+	p.paths[id] = path
+	p.ids[path] = id
+}
+
+// Remove removes an entry from the index.
+func (p *pathIndex) Remove(id uuid.UUID) {
+	if path, exists := p.paths[id]; exists {
+		delete(p.ids, path)
+		delete(p.paths, id)
+	}
+}
+
+// Path fetches the path of an entry given its ID.
+func (p *pathIndex) Path(id uuid.UUID) (string, bool) {
+	res, exists := p.paths[id]
+	return res, exists
+}
+
+// ID fetches the ID of an entry given its path.
+func (p *pathIndex) ID(path string) (uuid.UUID, bool) {
+	res, exists := p.ids[path]
+	return res, exists
+}
+
+// publicKeyIndex maps between account public keys and IDs.
+// Each account is indexed by both its aggregate public key and its local public key.
+type publicKeyIndex struct {
+	keys map[uuid.UUID]*accountPublicKeys
+	ids  map[string]uuid.UUID
+}
+
+// accountPublicKeys are the public keys of an account.
+type accountPublicKeys struct {
+	aggregate []byte
+	local     []byte
+}
+
+// newPublicKeyIndex creates a new public key index.
+func newPublicKeyIndex() *publicKeyIndex {
+	return &publicKeyIndex{
+		keys: make(map[uuid.UUID]*accountPublicKeys),
+		ids:  make(map[string]uuid.UUID),
+	}
+}
+
+// Add adds an entry to the index.
+func (p *publicKeyIndex) Add(id uuid.UUID, keys *accountPublicKeys) {
+	p.Remove(id)
+	p.keys[id] = keys
+	p.ids[string(keys.aggregate)] = id
+	p.ids[string(keys.local)] = id
+}
+
+// Remove removes an entry from the index.
+func (p *publicKeyIndex) Remove(id uuid.UUID) {
+	if keys, exists := p.keys[id]; exists {
+		delete(p.ids, string(keys.aggregate))
+		delete(p.ids, string(keys.local))
+		delete(p.keys, id)
+	}
+}
+
+// Keys fetches the public keys of an entry given its ID.
+func (p *publicKeyIndex) Keys(id uuid.UUID) (*accountPublicKeys, bool) {
+	res, exists := p.keys[id]
+	return res, exists
+}
+
+// ID fetches the ID of an entry given either its aggregate or local public key.
+func (p *publicKeyIndex) ID(key []byte) (uuid.UUID, bool) {
+	res, exists := p.ids[string(key)]
+	return res, exists
+}
+
+// publicKeys returns the public keys of an account.
+// The aggregate public key is the same as the local public key for local accounts, or if the key service's public
+// key is unavailable.
+func (a *account) publicKeys() *accountPublicKeys {
+	keys := &accountPublicKeys{
+		local: a.publicKey.Marshal(),
+	}
+	keys.aggregate = keys.local
+	if aggregate := a.PublicKey(); aggregate != nil {
+		keys.aggregate = aggregate.Marshal()
+	}
+	return keys
+}
+
+// flagIndex holds the flags of accounts, so that accounts can be recreated with them if their records are lost.
+type flagIndex struct {
+	flags map[uuid.UUID]*accountFlags
+}
+
+// accountFlags are the flags of an account, as stored in both the account's record and the index.
+type accountFlags struct {
+	Local             bool   `json:"local,omitempty"`
+	SigningAccount    string `json:"signingaccount,omitempty"`
+	WithdrawalAccount string `json:"withdrawalaccount,omitempty"`
+	Archived          bool   `json:"archived,omitempty"`
+}
+
+// newFlagIndex creates a new flag index.
+func newFlagIndex() *flagIndex {
+	return &flagIndex{
+		flags: make(map[uuid.UUID]*accountFlags),
+	}
+}
+
+// Add adds an entry to the index.
+func (f *flagIndex) Add(id uuid.UUID, flags *accountFlags) {
+	f.flags[id] = flags
+}
+
+// Remove removes an entry from the index.
+func (f *flagIndex) Remove(id uuid.UUID) {
+	delete(f.flags, id)
+}
+
+// Flags fetches the flags of an entry given its ID.
+func (f *flagIndex) Flags(id uuid.UUID) (*accountFlags, bool) {
+	res, exists := f.flags[id]
+	return res, exists
+}
+
+// flags returns the flags of an account.
+func (a *account) flags() *accountFlags {
+	flags := &accountFlags{
+		Local:    a.local,
+		Archived: a.archived,
+	}
+	if a.signingAccount != uuid.Nil {
+		flags.SigningAccount = a.signingAccount.String()
+	}
+	if a.withdrawalAccount != uuid.Nil {
+		flags.WithdrawalAccount = a.withdrawalAccount.String()
+	}
+	return flags
+}
+
+// links returns the IDs of the signing and withdrawal accounts linked to by the flags, which are nil if not present.
+func (f *accountFlags) links() (uuid.UUID, uuid.UUID, error) {
+	var err error
+	signingAccount := uuid.Nil
+	if f.SigningAccount != "" {
+		if signingAccount, err = uuid.Parse(f.SigningAccount); err != nil {
+			return uuid.Nil, uuid.Nil, errors.Wrap(err, "signing account invalid")
+		}
+	}
+	withdrawalAccount := uuid.Nil
+	if f.WithdrawalAccount != "" {
+		if withdrawalAccount, err = uuid.Parse(f.WithdrawalAccount); err != nil {
+			return uuid.Nil, uuid.Nil, errors.Wrap(err, "withdrawal account invalid")
+		}
+	}
+	return signingAccount, withdrawalAccount, nil
+}
+
+// apply sets the flags of an account.
+func (f *accountFlags) apply(a *account) error {
+	signingAccount, withdrawalAccount, err := f.links()
+	if err != nil {
+		return err
+	}
+	a.local = f.Local
+	if a.local {
+		a.keyService = nil
+	}
+	a.signingAccount = signingAccount
+	a.withdrawalAccount = withdrawalAccount
+	a.archived = f.Archived
+	return nil
+}
+
+// indexEntry is an entry in the stored accounts index.
+// This is a superset of the entries of go-indexer, so the stored index remains readable by it.
+type indexEntry struct {
+	ID   uuid.UUID `json:"uuid"`
+	Name string    `json:"name"`
+	Path string    `json:"path,omitempty"`
+	// PublicKey is the aggregate public key of the account.
+	PublicKey string `json:"pubkey,omitempty"`
+	// LocalPublicKey is the local public key of the account, if it differs from the aggregate public key.
+	LocalPublicKey string `json:"localpubkey,omitempty"`
+	// Flags are the flags of the account.
+	Flags *accountFlags `json:"flags,omitempty"`
+}
+
+// newIndexEntry creates an index entry.
+func newIndexEntry(id uuid.UUID, name string, path string, keys *accountPublicKeys, flags *accountFlags) *indexEntry {
+	entry := &indexEntry{
+		ID:    id,
+		Name:  name,
+		Path:  path,
+		Flags: flags,
+	}
+	if keys != nil {
+		entry.PublicKey = hex.EncodeToString(keys.aggregate)
+		if string(keys.local) != string(keys.aggregate) {
+			entry.LocalPublicKey = hex.EncodeToString(keys.local)
+		}
+	}
+	return entry
+}
+
+// serializeIndex serializes the name, path, public key and flag indices to a single stored index.
+func serializeIndex(index *indexer.Index, paths *pathIndex, pubKeys *publicKeyIndex, flags *flagIndex) ([]byte, error) {
+	data, err := index.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*indexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		keys, _ := pubKeys.Keys(entry.ID)
+		entries[i] = newIndexEntry(entry.ID, entry.Name, paths.paths[entry.ID], keys, flags.flags[entry.ID])
+	}
+	return json.Marshal(entries)
+}
+
+// deserializeIndex deserializes a stored index to name, path, public key and flag indices.
+// complete will be false if any of the entries does not have a path, public key or flags, as is the case for indices
+// stored by earlier versions.
+func deserializeIndex(data []byte) (*indexer.Index, *pathIndex, *publicKeyIndex, *flagIndex, bool, error) {
+	var entries []*indexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, nil, nil, nil, false, err
+	}
+	index := indexer.New()
+	paths := newPathIndex()
+	pubKeys := newPublicKeyIndex()
+	flags := newFlagIndex()
+	complete := true
+	for _, entry := range entries {
+		index.Add(entry.ID, entry.Name)
+		if entry.Path == "" {
+			complete = false
+		} else {
+			paths.Add(entry.ID, entry.Path)
+		}
+		keys, err := entry.publicKeys()
+		if err != nil {
+			return nil, nil, nil, nil, false, err
+		}
+		if keys == nil {
+			complete = false
+		} else {
+			pubKeys.Add(entry.ID, keys)
+		}
+		if entry.Flags == nil {
+			complete = false
+		} else {
+			flags.Add(entry.ID, entry.Flags)
+		}
+	}
+	return index, paths, pubKeys, flags, complete, nil
+}
+
+// publicKeys returns the public keys of an index entry, or nil if the entry does not have them.
+func (e *indexEntry) publicKeys() (*accountPublicKeys, error) {
+	if e.PublicKey == "" {
+		return nil, nil
+	}
+	keys := &accountPublicKeys{}
+	var err error
+	if keys.aggregate, err = hex.DecodeString(e.PublicKey); err != nil {
+		return nil, err
+	}
+	keys.local = keys.aggregate
+	if e.LocalPublicKey != "" {
+		if keys.local, err = hex.DecodeString(e.LocalPublicKey); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// addToIndex adds an account to the wallet's name, path, public key and flag indices.
+// If the serialized index is cached the account is appended to it in place, to avoid serializing the entire index
+// each time an account is created.  The cache is not shared with the store, which is given copies of it.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) addToIndex(a *account) {
+	if w.index.IDKnown(a.id) || w.index.NameKnown(a.name) {
+		// Replacing an existing entry; the index must be serialized afresh.
+		w.indexData = nil
+	}
+	keys := a.publicKeys()
+	flags := a.flags()
+	w.index.Add(a.id, a.name)
+	w.paths.Add(a.id, a.path)
+	w.pubKeys.Add(a.id, keys)
+	w.flags.Add(a.id, flags)
+	if len(w.indexData) < 2 {
+		w.indexData = nil
+		return
+	}
+
+	entry, err := json.Marshal(newIndexEntry(a.id, a.name, a.path, keys, flags))
+	if err != nil {
+		w.indexData = nil
+		return
+	}
+	// Replace the closing bracket with the entry.  append() grows the slice geometrically, so the cost of copying
+	// the index when it grows is spread across creations.
+	data := w.indexData[:len(w.indexData)-1]
+	if len(data) > 1 {
+		data = append(data, ',')
+	}
+	data = append(data, entry...)
+	w.indexData = append(data, ']')
+}
+
+// removeFromIndex removes an account from the wallet's name, path, public key and flag indices.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) removeFromIndex(id uuid.UUID, name string) {
+	w.index.Remove(id, name)
+	w.paths.Remove(id)
+	w.pubKeys.Remove(id)
+	w.flags.Remove(id)
+	w.indexData = nil
+}
+
+// updateIndexFlags updates the flags of an account in the wallet's index.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) updateIndexFlags(a *account) {
+	w.flags.Add(a.id, a.flags())
+	w.indexData = nil
+}
@@ -0,0 +1,294 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	util "github.com/wealdtech/go-eth2-util"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+func TestPathIndex(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 0", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	// The stored index contains the path, public keys and flags of the account.
+	data, err := store.RetrieveAccountsIndex(wallet.ID())
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`[{"uuid":"%s","name":"Account 0","path":"m/12381/3600/0/0","pubkey":"%x","localpubkey":"8a03fe6a3853aa04c5acaf3179d1a7c5235cdaafbdc0dfeccd3e25def538a5fce4afb6b49a7b3d457df123326a3c135f","flags":{}}]`, account.ID(), account.(e2wtypes.AccountPublicKeyProvider).PublicKey().Marshal()), string(data))
+
+	// Store the index as earlier versions did, without paths or public keys.
+	require.NoError(t, store.StoreAccountsIndex(wallet.ID(), []byte(fmt.Sprintf(`[{"uuid":"%s","name":"Account 0"}]`, account.ID()))))
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+
+	// Paths are recreated from the accounts.
+	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/0/0", "Account 0a", []byte("account passphrase"))
+	require.EqualError(t, err, `account with path "m/12381/3600/0/0" already exists`)
+	_, err = wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/1/0", "Account 1", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	// CreateAccount skips paths in use.
+	account, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 2", []byte("account passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, "m/12381/3600/2/0", account.(e2wtypes.AccountPathProvider).Path())
+
+	data, err = store.RetrieveAccountsIndex(wallet.ID())
+	require.NoError(t, err)
+	var entries []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &entries))
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.NotEmpty(t, entry["path"])
+		assert.NotEmpty(t, entry["pubkey"])
+		assert.NotNil(t, entry["flags"])
+	}
+}
+
+// indexCountingStore is a store that counts the times the accounts index is stored.
+type indexCountingStore struct {
+	*scratch.Store
+	indexWrites int
+	stored      [][]byte
+}
+
+func (s *indexCountingStore) StoreAccountsIndex(walletID uuid.UUID, data []byte) error {
+	s.indexWrites++
+	s.stored = append(s.stored, data)
+	return s.Store.StoreAccountsIndex(walletID, data)
+}
+
+func TestCreateAccountIndexWrites(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := &indexCountingStore{Store: scratch.New().(*scratch.Store)}
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+
+	for i := 0; i < 3; i++ {
+		store.indexWrites = 0
+		_, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("Account %d", i), []byte("account passphrase"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, store.indexWrites)
+
+		// Each stored index holds all of the accounts created so far.
+		data, err := store.RetrieveAccountsIndex(wallet.ID())
+		require.NoError(t, err)
+		var entries []map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &entries))
+		assert.Len(t, entries, i+1)
+	}
+
+	// Data given to the store is not altered afterwards.
+	require.Len(t, store.stored, 4)
+	for i, data := range store.stored {
+		var entries []map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &entries))
+		assert.Len(t, entries, i)
+	}
+}
+
+type accountByPublicKeyProvider interface {
+	AccountByPublicKey(ctx context.Context, pubKey []byte) (e2wtypes.Account, error)
+}
+
+func TestAccountByPublicKey(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account1, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 1", []byte("account passphrase"))
+	require.NoError(t, err)
+	account2, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 2", []byte("account passphrase"))
+	require.NoError(t, err)
+	aggregateKey := account2.(e2wtypes.AccountPublicKeyProvider).PublicKey().Marshal()
+	localPrivateKey, err := util.PrivateKeyFromSeedAndPath(seed, "m/12381/3600/1/0")
+	require.NoError(t, err)
+	localKey := localPrivateKey.PublicKey().Marshal()
+
+	tests := []struct {
+		name   string
+		pubKey []byte
+		id     uuid.UUID
+		err    string
+	}{
+		{
+			name:   "Aggregate",
+			pubKey: aggregateKey,
+			id:     account2.ID(),
+		},
+		{
+			name:   "Local",
+			pubKey: localKey,
+			id:     account2.ID(),
+		},
+		{
+			name:   "Other",
+			pubKey: account1.(e2wtypes.AccountPublicKeyProvider).PublicKey().Marshal(),
+			id:     account1.ID(),
+		},
+		{
+			name:   "Unknown",
+			pubKey: pubkey,
+			err:    fmt.Sprintf("no account with public key %#x", pubkey),
+		},
+	}
+
+	check := func(t *testing.T, wallet e2wtypes.Wallet) {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				account, err := wallet.(accountByPublicKeyProvider).AccountByPublicKey(context.Background(), test.pubKey)
+				if test.err != "" {
+					require.EqualError(t, err, test.err)
+					assert.True(t, errors.Is(err, mpc.ErrNotFound))
+				} else {
+					require.NoError(t, err)
+					assert.Equal(t, test.id, account.ID())
+				}
+			})
+		}
+	}
+
+	check(t, wallet)
+
+	// The public keys are persisted in the index.
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	t.Run("Reopened", func(t *testing.T) { check(t, wallet) })
+
+	// The public keys are recreated for an index stored by earlier versions.
+	require.NoError(t, store.StoreAccountsIndex(wallet.ID(), []byte(fmt.Sprintf(`[{"uuid":"%s","name":"Account 1"},{"uuid":"%s","name":"Account 2"}]`, account1.ID(), account2.ID()))))
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	t.Run("Legacy", func(t *testing.T) { check(t, wallet) })
+}
+
+// nullEncryptor is an encryptor that does not encrypt, to remove the cost of encryption from benchmarks.
+type nullEncryptor struct{}
+
+func (e *nullEncryptor) Name() string {
+	return "keystore"
+}
+
+func (e *nullEncryptor) Version() uint {
+	return 4
+}
+
+func (e *nullEncryptor) Encrypt(data []byte, passphrase string) (map[string]interface{}, error) {
+	return map[string]interface{}{"data": hex.EncodeToString(data)}, nil
+}
+
+func (e *nullEncryptor) Decrypt(data map[string]interface{}, passphrase string) ([]byte, error) {
+	return hex.DecodeString(data["data"].(string))
+}
+
+// _populatedWallet is a helper to create an unlocked wallet with the given number of accounts.
+// The accounts are copies of a single account written directly to the store, to keep setup fast.
+func _populatedWallet(b *testing.B, accounts int) e2wtypes.Wallet {
+	seed := make([]byte, 64)
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := &nullEncryptor{}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", nil, store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(b, err)
+	require.NoError(b, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), nil))
+	account, err := wallet.(e2wtypes.WalletPathedAccountCreator).CreatePathedAccount(context.Background(), "m/12381/3600/999999/0", "Template", nil)
+	require.NoError(b, err)
+	data, err := store.RetrieveAccount(wallet.ID(), account.ID())
+	require.NoError(b, err)
+	var record map[string]interface{}
+	require.NoError(b, json.Unmarshal(data, &record))
+
+	entries := make([]map[string]string, 0, accounts)
+	for i := 0; i < accounts; i++ {
+		id := uuid.New()
+		record["uuid"] = id.String()
+		record["name"] = fmt.Sprintf("Account %d", i)
+		record["path"] = fmt.Sprintf("m/12381/3600/%d/0", i)
+		data, err := json.Marshal(record)
+		require.NoError(b, err)
+		require.NoError(b, store.StoreAccount(wallet.ID(), id, data))
+		entries = append(entries, map[string]string{"uuid": id.String(), "name": record["name"].(string), "path": record["path"].(string)})
+	}
+	data, err = json.Marshal(entries)
+	require.NoError(b, err)
+	require.NoError(b, store.StoreAccountsIndex(wallet.ID(), data))
+
+	data, err = store.RetrieveWallet("test wallet")
+	require.NoError(b, err)
+	var walletRecord map[string]interface{}
+	require.NoError(b, json.Unmarshal(data, &walletRecord))
+	walletRecord["nextaccount"] = accounts
+	data, err = json.Marshal(walletRecord)
+	require.NoError(b, err)
+	require.NoError(b, store.StoreWallet(wallet.ID(), "test wallet", data))
+
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(b, err)
+	require.NoError(b, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), nil))
+	return wallet
+}
+
+func BenchmarkCreateAccount(b *testing.B) {
+	for _, accounts := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("Accounts%d", accounts), func(b *testing.B) {
+			wallet := _populatedWallet(b, accounts)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("New account %d", i), nil)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// checkName checks that a name for a wallet or account, as given by kind, follows the naming rules.
+// The only rule for names is that they cannot start with an underscore (_) character.
+func checkName(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s name missing", kind)
+	}
+	if strings.HasPrefix(name, "_") {
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// RenameWallet renames the wallet.
+// The name follows the same rules as account names, and must not be in use by another wallet in the store.
+// The wallet must be unlocked.
+func (w *wallet) RenameWallet(ctx context.Context, name string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := checkName("wallet", name); err != nil {
+		return err
+	}
+	if !w.isUnlocked() {
+		return newError(ErrLocked, "wallet must be unlocked to rename it")
+	}
+	if name == w.name {
+		return nil
+	}
+	if _, err := w.store.RetrieveWallet(name); err == nil {
+		return newErrorf(ErrAlreadyExists, "wallet %q already exists", name)
+	} else if !isStoreNotFound(err) {
+		return errors.Wrapf(err, "failed to check for existing wallet %q", name)
+	}
+
+	oldName := w.name
+	w.name = name
+	data, err := json.Marshal(w)
+	if err != nil {
+		w.name = oldName
+		return errors.Wrap(err, "failed to serialize wallet")
+	}
+	if err := w.store.StoreWallet(w.id, w.name, data); err != nil {
+		w.name = oldName
+		return errors.Wrapf(err, "failed to store renamed wallet %q", name)
+	}
+
+	return nil
+}
+
+// RenameAccount renames the account with the given ID.
+// The name follows the same rules as for CreatePathedAccount(), and must not be in use by another account in the
+// wallet.  The index and the account are both updated; if either cannot be stored the other is restored.
+// The wallet must be unlocked.
+func (w *wallet) RenameAccount(ctx context.Context, id uuid.UUID, name string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := checkName("account", name); err != nil {
+		return err
+	}
+	if !w.isUnlocked() {
+		return newError(ErrLocked, "wallet must be unlocked to rename accounts")
+	}
+	oldName, exists := w.index.Name(id)
+	if !exists {
+		return newError(ErrNotFound, "account not found")
+	}
+	if name == oldName {
+		return nil
+	}
+	if w.index.NameKnown(name) {
+		return newErrorf(ErrAlreadyExists, "account with name %q already exists", name)
+	}
+	acc, err := w.accountByID(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "failed to obtain account %q", oldName)
+	}
+	a := acc.(*account)
+	a.name = name
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize account %q", oldName)
+	}
+
+	w.index.Remove(id, oldName)
+	w.index.Add(id, name)
+	w.indexData = nil
+	if err := w.storeAccountsIndex(); err != nil {
+		w.index.Remove(id, name)
+		w.index.Add(id, oldName)
+		w.indexData = nil
+		return errors.Wrapf(err, "failed to update index to rename account %q", oldName)
+	}
+	if err := w.store.StoreAccount(w.id, id, data); err != nil {
+		w.index.Remove(id, name)
+		w.index.Add(id, oldName)
+		w.indexData = nil
+		if restoreErr := w.storeAccountsIndex(); restoreErr != nil {
+			return errors.Wrapf(err, "failed to store renamed account %q, and failed to restore index (%v)", oldName, restoreErr)
+		}
+		return errors.Wrapf(err, "failed to store renamed account %q", oldName)
+	}
+
+	return nil
+}
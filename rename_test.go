@@ -0,0 +1,230 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type walletRenamer interface {
+	RenameWallet(ctx context.Context, name string) error
+	RenameAccount(ctx context.Context, id uuid.UUID, name string) error
+}
+
+func TestRenameWallet(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	_, err = mpc.CreateWallet(context.Background(), "other wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+
+	err = wallet.(walletRenamer).RenameWallet(context.Background(), "renamed wallet")
+	assert.EqualError(t, err, "wallet must be unlocked to rename it")
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+
+	tests := []struct {
+		name    string
+		newName string
+		err     string
+		kind    error
+	}{
+		{
+			name: "Missing",
+			err:  "wallet name missing",
+		},
+		{
+			name:    "Underscore",
+			newName: "_wallet",
+			err:     `invalid wallet name "_wallet"`,
+		},
+		{
+			name:    "Exists",
+			newName: "other wallet",
+			err:     `wallet "other wallet" already exists`,
+			kind:    mpc.ErrAlreadyExists,
+		},
+		{
+			name:    "Unchanged",
+			newName: "test wallet",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := wallet.(walletRenamer).RenameWallet(context.Background(), test.newName)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				if test.kind != nil {
+					assert.True(t, errors.Is(err, test.kind))
+				}
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, "test wallet", wallet.Name())
+		})
+	}
+
+	require.NoError(t, wallet.(walletRenamer).RenameWallet(context.Background(), "renamed wallet"))
+	assert.Equal(t, "renamed wallet", wallet.Name())
+	_, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	assert.True(t, errors.Is(err, mpc.ErrNotFound))
+	reopened, err := mpc.OpenWallet(context.Background(), "renamed wallet", store, encryptor)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.ID(), reopened.ID())
+}
+
+func TestRenameAccount(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 1", []byte("account passphrase"))
+	require.NoError(t, err)
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 2", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		id      uuid.UUID
+		newName string
+		err     string
+		kind    error
+	}{
+		{
+			name: "Missing",
+			id:   account.ID(),
+			err:  "account name missing",
+		},
+		{
+			name:    "Underscore",
+			id:      account.ID(),
+			newName: "_account",
+			err:     `invalid account name "_account"`,
+		},
+		{
+			name:    "Exists",
+			id:      account.ID(),
+			newName: "Account 2",
+			err:     `account with name "Account 2" already exists`,
+			kind:    mpc.ErrAlreadyExists,
+		},
+		{
+			name:    "Unknown",
+			id:      uuid.New(),
+			newName: "Account 3",
+			err:     "account not found",
+			kind:    mpc.ErrNotFound,
+		},
+		{
+			name:    "Unchanged",
+			id:      account.ID(),
+			newName: "Account 1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := wallet.(walletRenamer).RenameAccount(context.Background(), test.id, test.newName)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				if test.kind != nil {
+					assert.True(t, errors.Is(err, test.kind))
+				}
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+	err = wallet.(walletRenamer).RenameAccount(context.Background(), account.ID(), "Renamed")
+	assert.EqualError(t, err, "wallet must be unlocked to rename accounts")
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	require.NoError(t, wallet.(walletRenamer).RenameAccount(context.Background(), account.ID(), "Renamed"))
+
+	// Both the index and the account are updated.
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	_, err = reopened.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 1")
+	assert.True(t, errors.Is(err, mpc.ErrNotFound))
+	renamed, err := reopened.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Renamed")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID(), renamed.ID())
+	assert.Equal(t, "Renamed", renamed.Name())
+
+	// The old name can be reused.
+	_, err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Account 1", []byte("account passphrase"))
+	require.NoError(t, err)
+}
+
+// nameFailingStore fails to retrieve wallets with a given name.
+type nameFailingStore struct {
+	*scratch.Store
+	name string
+}
+
+func (s *nameFailingStore) RetrieveWallet(walletName string) ([]byte, error) {
+	if walletName == s.name {
+		return nil, errors.New("disk failure")
+	}
+	return s.Store.RetrieveWallet(walletName)
+}
+
+func TestRenameWalletStoreError(t *testing.T) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := &nameFailingStore{Store: scratch.New().(*scratch.Store), name: "renamed wallet"}
+	encryptor := keystorev4.New()
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+
+	// A failure to check for an existing wallet does not allow the rename.
+	err = wallet.(walletRenamer).RenameWallet(context.Background(), "renamed wallet")
+	require.EqualError(t, err, `failed to check for existing wallet "renamed wallet": disk failure`)
+	assert.Equal(t, "test wallet", wallet.Name())
+	_, err = mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+}
@@ -0,0 +1,62 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	ssz "github.com/prysmaticlabs/go-ssz"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+)
+
+// signingData is the structure from which a signing root is calculated.
+type signingData struct {
+	ObjectRoot []byte `ssz-size:"32"`
+	Domain     []byte `ssz-size:"32"`
+}
+
+// signingRoot calculates the signing root for an object root in a given domain.
+func signingRoot(objectRoot []byte, domain []byte) ([]byte, error) {
+	root, err := ssz.HashTreeRoot(&signingData{
+		ObjectRoot: objectRoot,
+		Domain:     domain,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate signing root")
+	}
+	return root[:], nil
+}
+
+// signObjectRoot signs an object root in a given domain, verifying the aggregate signature before returning it.
+// The request supplies the details of the object to key services that use the Web3Signer protocol, replacing any
+// request in the context.
+func (a *account) signObjectRoot(ctx context.Context, objectRoot []byte, domain []byte, request *Web3SignerRequest) (e2types.Signature, error) {
+	root, err := signingRoot(objectRoot, domain)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := a.Sign(WithWeb3SignerRequest(ctx, request), root)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign")
+	}
+	publicKey := a.PublicKey()
+	if publicKey == nil {
+		return nil, errors.New("failed to obtain public key")
+	}
+	if !signature.Verify(root, publicKey) {
+		return nil, errors.New("signature does not verify against public key")
+	}
+	return signature, nil
+}
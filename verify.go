@@ -0,0 +1,228 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	util "github.com/wealdtech/go-eth2-util"
+)
+
+// VerifiedAccount is an account reported by VerifyAndRepair().
+type VerifiedAccount struct {
+	ID   uuid.UUID `json:"uuid"`
+	Name string    `json:"name"`
+	Path string    `json:"path"`
+}
+
+// VerifyReport is the result of VerifyAndRepair().
+type VerifyReport struct {
+	// Verified are the accounts whose local keys match the keys derived from the wallet's seed.
+	Verified []*VerifiedAccount `json:"verified"`
+	// Mismatched are the accounts whose local keys do not match the keys derived from the wallet's seed.
+	Mismatched []*VerifiedAccount `json:"mismatched"`
+	// Missing are the paths of accounts that should exist but were not found, and were not recreated.
+	Missing []string `json:"missing"`
+	// Recreated are the accounts that were not found, and have been recreated.
+	Recreated []*VerifiedAccount `json:"recreated"`
+	// Unrecoverable are the accounts that were not found, and were not recreated because their flags could not be
+	// recovered.  Their IDs are nil and names empty if not known.
+	Unrecoverable []*VerifiedAccount `json:"unrecoverable"`
+}
+
+// accountRecord is the part of an account's stored record with which the account can be recreated.
+type accountRecord struct {
+	ID   string `json:"uuid"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+	accountFlags
+}
+
+// VerifyAndRepair verifies the accounts of the wallet against its seed.
+// The local key of each account is derived from the seed and its path, and compared with the account's stored
+// public key.  Paths for account numbers below the wallet's next account number that do not have an account are
+// reported as missing.
+// If passphrase is not nil missing accounts are recreated, encrypted with the passphrase.  An account is recreated
+// with the flags in its record, if the record is present but cannot be decoded, or else those in the wallet's index,
+// so that an account that was archived or linked to a withdrawal account remains so.  An account whose flags cannot
+// be recovered from either is not recreated, as it might have been archived or deleted, and is reported as
+// unrecoverable.  An account that is still in the wallet's index is recreated with the ID and name recorded there;
+// otherwise it is given those in its record, or a new ID and name.
+// Mismatched accounts are reported but not altered.
+// The wallet must be unlocked.
+func (w *wallet) VerifyAndRepair(ctx context.Context, passphrase []byte) (*VerifyReport, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.isUnlocked() {
+		return nil, newError(ErrLocked, "wallet must be unlocked to verify accounts")
+	}
+	w.autoLock.touch()
+
+	report := &VerifyReport{
+		Verified:      make([]*VerifiedAccount, 0),
+		Mismatched:    make([]*VerifiedAccount, 0),
+		Missing:       make([]string, 0),
+		Recreated:     make([]*VerifiedAccount, 0),
+		Unrecoverable: make([]*VerifiedAccount, 0),
+	}
+	stored := w.retrieveStoredAccounts()
+	paths := make(map[string]bool)
+	for _, a := range w.decodeAccounts(stored) {
+		paths[a.path] = true
+		verified := &VerifiedAccount{
+			ID:   a.id,
+			Name: a.name,
+			Path: a.path,
+		}
+		privateKey, err := util.PrivateKeyFromSeedAndPath(w.seed, a.path)
+		if err != nil || !bytes.Equal(privateKey.PublicKey().Marshal(), a.publicKey.Marshal()) {
+			report.Mismatched = append(report.Mismatched, verified)
+			continue
+		}
+		report.Verified = append(report.Verified, verified)
+	}
+	// The records of missing accounts are those that cannot be decoded, as decoded accounts are not missing.
+	records := make(map[string]*accountRecord)
+	for _, data := range stored {
+		record := &accountRecord{}
+		if err := json.Unmarshal(data, record); err == nil && record.Path != "" && !paths[record.Path] {
+			records[record.Path] = record
+		}
+	}
+
+	for accountNum := uint64(0); accountNum < w.nextAccount; accountNum++ {
+		path := fmt.Sprintf(w.pathTemplate, accountNum)
+		if paths[path] {
+			continue
+		}
+		if passphrase == nil {
+			report.Missing = append(report.Missing, path)
+			continue
+		}
+		id, name, flags := w.recreatedAccountDetails(path, accountNum, records[path])
+		if flags == nil {
+			report.Unrecoverable = append(report.Unrecoverable, &VerifiedAccount{
+				ID:   id,
+				Name: name,
+				Path: path,
+			})
+			continue
+		}
+		a, err := w.recreateAccount(ctx, path, id, name, flags, passphrase)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to recreate account at path %q", path)
+		}
+		report.Recreated = append(report.Recreated, &VerifiedAccount{
+			ID:   a.ID(),
+			Name: a.Name(),
+			Path: path,
+		})
+	}
+
+	return report, nil
+}
+
+// recreatedAccountDetails returns the ID, name and flags with which to recreate the missing account at the given
+// path, from the wallet's index and the account's undecodable record, which can be nil.
+// flags is nil if the flags cannot be recovered, in which case the account must not be recreated; the ID and name are
+// then those known, if any.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) recreatedAccountDetails(path string, accountNum uint64, record *accountRecord) (uuid.UUID, string, *accountFlags) {
+	id, indexed := w.paths.ID(path)
+	if !indexed && record != nil {
+		// The record's ID is used unless the index has it at another path.
+		if recordID, err := uuid.Parse(record.ID); err == nil {
+			if recordPath, exists := w.paths.Path(recordID); !exists || recordPath == path {
+				id = recordID
+				indexed = w.index.IDKnown(id)
+			}
+		}
+	}
+	var name string
+	var flags *accountFlags
+	if indexed {
+		name, _ = w.index.Name(id)
+		flags, _ = w.flags.Flags(id)
+	} else if record != nil && id != uuid.Nil && checkName("account", record.Name) == nil && !w.index.NameKnown(record.Name) {
+		name = record.Name
+	}
+	if record != nil {
+		flags = &record.accountFlags
+	}
+	if flags != nil {
+		if _, _, err := flags.links(); err != nil {
+			flags = nil
+		}
+	}
+	if flags != nil && name == "" {
+		name = w.recreatedAccountName(accountNum)
+	}
+	return id, name, flags
+}
+
+// recreateAccount recreates a missing account at the given path, with the given ID, name and flags.
+// If the ID is nil the account is given a new ID.  If the index still refers to the missing account its entry is
+// replaced.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) recreateAccount(ctx context.Context, path string, id uuid.UUID, name string, flags *accountFlags, passphrase []byte) (*account, error) {
+	// Remove any entry first, as it would otherwise clash with the recreated account.
+	indexedName, indexed := w.index.Name(id)
+	indexedPath, hasPath := w.paths.Path(id)
+	keys, hasKeys := w.pubKeys.Keys(id)
+	indexedFlags, hasFlags := w.flags.Flags(id)
+	if indexed {
+		w.removeFromIndex(id, indexedName)
+	}
+	a, err := w.newPathedAccount(ctx, path, name, passphrase)
+	if err == nil {
+		err = flags.apply(a)
+	}
+	if err != nil {
+		if indexed {
+			w.index.Add(id, indexedName)
+			if hasPath {
+				w.paths.Add(id, indexedPath)
+			}
+			if hasKeys {
+				w.pubKeys.Add(id, keys)
+			}
+			if hasFlags {
+				w.flags.Add(id, indexedFlags)
+			}
+		}
+		return nil, err
+	}
+	if id != uuid.Nil {
+		a.id = id
+	}
+	w.addToIndex(a)
+	return a, a.storeAccount()
+}
+
+// recreatedAccountName returns an unused name for a recreated account.
+func (w *wallet) recreatedAccountName(accountNum uint64) string {
+	name := fmt.Sprintf("Recovered account %d", accountNum)
+	for i := 2; ; i++ {
+		if _, exists := w.index.ID(name); !exists {
+			return name
+		}
+		name = fmt.Sprintf("Recovered account %d (%d)", accountNum, i)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type walletVerifier interface {
+	VerifyAndRepair(ctx context.Context, passphrase []byte) (*mpc.VerifyReport, error)
+}
+
+func TestVerifyAndRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestVerifyAndRepair")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := filesystem.New(dir)
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+
+	_, err = wallet.(walletVerifier).VerifyAndRepair(context.Background(), nil)
+	require.EqualError(t, err, "wallet must be unlocked to verify accounts")
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	accounts := make([]e2wtypes.Account, 3)
+	for i := range accounts {
+		accounts[i], err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("Account %d", i), []byte("account passphrase"))
+		require.NoError(t, err)
+	}
+
+	report, err := wallet.(walletVerifier).VerifyAndRepair(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, report.Verified, 3)
+	assert.Len(t, report.Mismatched, 0)
+	assert.Len(t, report.Missing, 0)
+
+	// Lose the second account, and corrupt the public key of the third.
+	require.NoError(t, os.Remove(filepath.Join(dir, wallet.ID().String(), accounts[1].ID().String())))
+	data, err := store.RetrieveAccount(wallet.ID(), accounts[2].ID())
+	require.NoError(t, err)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &record))
+	otherKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	record["pubkey"] = fmt.Sprintf("%x", otherKey.PublicKey().Marshal())
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccount(wallet.ID(), accounts[2].ID(), data))
+
+	report, err = wallet.(walletVerifier).VerifyAndRepair(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, report.Verified, 1)
+	assert.Equal(t, accounts[0].ID(), report.Verified[0].ID)
+	require.Len(t, report.Mismatched, 1)
+	assert.Equal(t, accounts[2].ID(), report.Mismatched[0].ID)
+	assert.Equal(t, "m/12381/3600/2/0", report.Mismatched[0].Path)
+	assert.Equal(t, []string{"m/12381/3600/1/0"}, report.Missing)
+	assert.Len(t, report.Recreated, 0)
+
+	report, err = wallet.(walletVerifier).VerifyAndRepair(context.Background(), []byte("new account passphrase"))
+	require.NoError(t, err)
+	assert.Len(t, report.Missing, 0)
+	require.Len(t, report.Recreated, 1)
+	// The account is recreated with the ID and name in the index.
+	assert.Equal(t, accounts[1].ID(), report.Recreated[0].ID)
+	assert.Equal(t, "Account 1", report.Recreated[0].Name)
+	assert.Equal(t, "m/12381/3600/1/0", report.Recreated[0].Path)
+
+	recreated, err := wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), report.Recreated[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, accounts[1].PublicKey().Marshal(), recreated.PublicKey().Marshal())
+	require.NoError(t, recreated.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("new account passphrase")))
+
+	// The recreated account is now verified.
+	report, err = wallet.(walletVerifier).VerifyAndRepair(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, report.Verified, 2)
+	assert.Len(t, report.Missing, 0)
+
+	// The recreated account is found by its name, with no orphaned entries left in the stored index.
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	byName, err := reopened.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Account 1")
+	require.NoError(t, err)
+	assert.Equal(t, accounts[1].ID(), byName.ID())
+	_, err = reopened.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Recovered account 1")
+	assert.True(t, errors.Is(err, mpc.ErrNotFound))
+	names := make([]string, 0)
+	for account := range reopened.Accounts(context.Background()) {
+		names = append(names, account.Name())
+	}
+	assert.ElementsMatch(t, []string{"Account 0", "Account 1", "Account 2"}, names)
+}
+
+func TestVerifyAndRepairFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestVerifyAndRepairFlags")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("a99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c")
+	store := filesystem.New(dir)
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, keystorev4.New(), seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	accounts := make([]e2wtypes.Account, 4)
+	for i := range accounts {
+		accounts[i], err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), fmt.Sprintf("Account %d", i), []byte("account passphrase"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, wallet.(accountDeleter).ArchiveAccount(context.Background(), accounts[0].ID()))
+	withdrawal, err := wallet.(withdrawalAccountCreator).CreateWithdrawalAccount(context.Background(), "Account 1", "Withdrawal 1", []byte("account passphrase"), true)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(accountDeleter).DeleteAccount(context.Background(), accounts[3].ID()))
+
+	// Lose the archived and linked accounts.
+	require.NoError(t, os.Remove(filepath.Join(dir, wallet.ID().String(), accounts[0].ID().String())))
+	require.NoError(t, os.Remove(filepath.Join(dir, wallet.ID().String(), accounts[1].ID().String())))
+
+	// They are recreated with the flags in the index; the deleted account is not recreated.
+	report, err := wallet.(walletVerifier).VerifyAndRepair(context.Background(), []byte("new account passphrase"))
+	require.NoError(t, err)
+	require.Len(t, report.Recreated, 2)
+	require.Len(t, report.Unrecoverable, 1)
+	assert.Equal(t, "m/12381/3600/3/0", report.Unrecoverable[0].Path)
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	archived, err := reopened.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), accounts[0].ID())
+	require.NoError(t, err)
+	assert.True(t, archived.(interface{ IsArchived() bool }).IsArchived())
+	linked, err := reopened.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), accounts[1].ID())
+	require.NoError(t, err)
+	assert.Equal(t, withdrawal.ID(), linked.(withdrawalAccount).WithdrawalAccountID())
+	assert.False(t, linked.(withdrawalAccount).IsLocal())
+
+	// Archive the third account and make its record undecodable, lose the archived account again, and store the
+	// index as earlier versions did, without flags.
+	require.NoError(t, wallet.(accountDeleter).ArchiveAccount(context.Background(), accounts[2].ID()))
+	data, err := store.RetrieveAccount(wallet.ID(), accounts[2].ID())
+	require.NoError(t, err)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &record))
+	record["pubkey"] = "bad"
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccount(wallet.ID(), accounts[2].ID(), data))
+	require.NoError(t, os.Remove(filepath.Join(dir, wallet.ID().String(), accounts[0].ID().String())))
+	data, err = store.RetrieveAccountsIndex(wallet.ID())
+	require.NoError(t, err)
+	var entries []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &entries))
+	for _, entry := range entries {
+		delete(entry, "flags")
+	}
+	data, err = json.Marshal(entries)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreAccountsIndex(wallet.ID(), data))
+
+	wallet, err = mpc.OpenWallet(context.Background(), "test wallet", store, keystorev4.New())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	report, err = wallet.(walletVerifier).VerifyAndRepair(context.Background(), []byte("new account passphrase"))
+	require.NoError(t, err)
+
+	// The account with the undecodable record is recreated with the flags in its record.
+	require.Len(t, report.Recreated, 1)
+	assert.Equal(t, accounts[2].ID(), report.Recreated[0].ID)
+	recreated, err := wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), accounts[2].ID())
+	require.NoError(t, err)
+	assert.True(t, recreated.(interface{ IsArchived() bool }).IsArchived())
+
+	// The lost archived account has no flags in either, so is not recreated.
+	require.Len(t, report.Unrecoverable, 2)
+	assert.Equal(t, "m/12381/3600/0/0", report.Unrecoverable[0].Path)
+	assert.Equal(t, "m/12381/3600/3/0", report.Unrecoverable[1].Path)
+	_, err = store.RetrieveAccount(wallet.ID(), accounts[0].ID())
+	assert.Error(t, err)
+}
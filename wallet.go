@@ -18,15 +18,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/wealdtech/go-ecodec"
 	util "github.com/wealdtech/go-eth2-util"
-	e2types "github.com/wealdtech/go-eth2-types/v2"
 	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
 	"github.com/wealdtech/go-indexer"
 )
@@ -46,17 +48,51 @@ type wallet struct {
 	nextAccount uint64
 	store       e2wtypes.Store
 	encryptor   e2wtypes.Encryptor
-	mutex       *sync.RWMutex
-	index       *indexer.Index
-	keyService  *keyService
+	// seedEncryptor is the encryptor that protects the seed, which differs from encryptor if the wallet was opened
+	// with a different encryptor from that with which the seed was last encrypted.
+	seedEncryptor e2wtypes.Encryptor
+	// mutex protects the wallet's lock state, its indices and its stored data.
+	mutex      sync.RWMutex
+	index      *indexer.Index
+	keyService *keyService
+	// pathTemplate is the template for the paths of accounts created by CreateAccount().
+	pathTemplate string
+	// paths is the index of account paths, used to avoid scanning all accounts for path collisions.
+	paths *pathIndex
+	// pubKeys is the index of account public keys, used to look up accounts by public key.
+	pubKeys *publicKeyIndex
+	// flags is the index of account flags, with which accounts whose records are lost are recreated.
+	flags *flagIndex
+	// indexData is the cached serialized index, or nil if it must be serialized afresh.
+	indexData []byte
+	// accountsMutex protects unlockedAccounts, retiredAccounts, the auto-lock defaults for accounts and lockObserver.
+	accountsMutex sync.Mutex
+	// unlockedAccounts is the number of unlocked instances of each account, which cannot be deleted or archived.
+	unlockedAccounts map[uuid.UUID]int
+	// retiredAccounts holds the reasons that deleted and archived accounts can no longer be unlocked.
+	retiredAccounts map[uuid.UUID]error
+	// autoLock locks the wallet automatically after its timeouts.
+	autoLock *autoLock
+	// accountsIdle and accountsAbsolute are the default auto-lock timeouts for accounts.
+	accountsIdle     time.Duration
+	accountsAbsolute time.Duration
+	// lockObserver is called when the wallet or its accounts are locked or unlocked.
+	lockObserver LockObserver
+	// memoryLocking is true if the seed is locked in memory whilst the wallet is unlocked.
+	memoryLocking bool
 }
 
 // newWallet creates a new wallet
 func newWallet() *wallet {
-	return &wallet{
-		mutex: new(sync.RWMutex),
-		index: indexer.New(),
-	}
+	w := &wallet{
+		index:        indexer.New(),
+		paths:        newPathIndex(),
+		pubKeys:      newPublicKeyIndex(),
+		flags:        newFlagIndex(),
+		pathTemplate: defaultPathTemplate,
+	}
+	w.autoLock = newAutoLock(w.autoLocked)
+	return w
 }
 
 // MarshalJSON implements custom JSON marshaller.
@@ -68,7 +104,14 @@ func (w *wallet) MarshalJSON() ([]byte, error) {
 	data["type"] = walletType
 	data["crypto"] = w.crypto
 	data["keyService"] = w.keyService
+	if w.seedEncryptor != nil {
+		data["encryptor"] = w.seedEncryptor.Name()
+		data["encryptorversion"] = w.seedEncryptor.Version()
+	}
 	data["nextaccount"] = w.nextAccount
+	if w.pathTemplate != defaultPathTemplate {
+		data["pathtemplate"] = w.pathTemplate
+	}
 	return json.Marshal(data)
 }
 
@@ -151,6 +194,39 @@ func (w *wallet) UnmarshalJSON(data []byte) error {
 	} else {
 		return errors.New("wallet version missing")
 	}
+	if val, exists := v["pathtemplate"]; exists {
+		pathTemplate, ok := val.(string)
+		if !ok {
+			return errors.New("wallet path template invalid")
+		}
+		if err := validatePathTemplate(pathTemplate); err != nil {
+			return err
+		}
+		w.pathTemplate = pathTemplate
+	} else {
+		w.pathTemplate = defaultPathTemplate
+	}
+	if val, exists := v["encryptor"]; exists {
+		name, ok := val.(string)
+		if !ok {
+			return errors.New("wallet encryptor invalid")
+		}
+		val, exists := v["encryptorversion"]
+		if !exists {
+			return errors.New("wallet encryptor version missing")
+		}
+		encryptorVersion, ok := val.(float64)
+		if !ok {
+			return errors.New("wallet encryptor version invalid")
+		}
+		// Any encryptor already set is that with which the wallet is being opened, which is preferred if it
+		// protected the seed.
+		encryptor, err := resolveEncryptor(w.encryptor, name, uint(encryptorVersion))
+		if err != nil {
+			return err
+		}
+		w.seedEncryptor = encryptor
+	}
 	// use RawMessage to pass keyService value to its custom JSON unmarshaler
 	var vRaw map[string]*json.RawMessage
 	if err := json.Unmarshal(data, &vRaw); err != nil {
@@ -171,32 +247,70 @@ func (w *wallet) UnmarshalJSON(data []byte) error {
 }
 
 // CreateWallet creates a wallet with the given name from a seed and stores it in the provided store.
+// This is equivalent to CreateWalletWithOptions() with the WithSeed() and WithKeyService() options.
 func CreateWallet(ctx context.Context, name string, passphrase []byte, store e2wtypes.Store, encryptor e2wtypes.Encryptor, seed []byte, keyService string, pubKey []byte) (e2wtypes.Wallet, error) {
-	// First, try to open the wallet.
-	_, err := OpenWallet(ctx, name, store, encryptor)
-	if err == nil || !strings.Contains(err.Error(), "wallet not found") {
-		return nil, fmt.Errorf("wallet %q already exists", name)
-	}
-
-	id, err := uuid.NewRandom()
+	w, err := CreateWalletWithOptions(ctx, name, passphrase, store, encryptor, WithKeyService(keyService, pubKey), WithSeed(seed))
 	if err != nil {
+		// Return option errors without the name of the option, as they were before options existed.
+		var optionErr *OptionError
+		if errors.As(err, &optionErr) {
+			return nil, optionErr.Err
+		}
 		return nil, err
 	}
+	return w, nil
+}
 
-	ks := newKeyService()
-	url, err := url.Parse(keyService)
+// CreateWalletWithOptions creates a wallet with the given name and stores it in the provided store.
+// The WithKeyService() and WithSeed() options are required.
+// If an option is invalid the error returned is an *OptionError.
+func CreateWalletWithOptions(ctx context.Context, name string, passphrase []byte, store e2wtypes.Store, encryptor e2wtypes.Encryptor, opts ...Option) (e2wtypes.Wallet, error) {
+	o := &options{
+		keyServiceProtocol: keyServiceProtocolMPC,
+		pathTemplate:       defaultPathTemplate,
+	}
+	for _, opt := range opts {
+		if err := opt.apply(o); err != nil {
+			return nil, err
+		}
+	}
+	if o.keyServiceURL == nil {
+		return nil, errors.New("key service required")
+	}
+	if o.seed == nil {
+		return nil, errors.New("seed required")
+	}
+	if o.unverifiedRecovery {
+		return nil, &OptionError{Option: "WithUnverifiedRecovery", Err: errors.New("only supported when recovering a wallet")}
+	}
+	client, err := o.client()
 	if err != nil {
 		return nil, err
 	}
-	ks.url = url
-	blsPubKey, err := e2types.BLSPublicKeyFromBytes(pubKey)
+
+	// First, try to open the wallet.
+	_, err = OpenWallet(ctx, name, store, encryptor)
+	switch {
+	case err == nil:
+		return nil, newErrorf(ErrAlreadyExists, "wallet %q already exists", name)
+	case !errors.Is(err, ErrNotFound):
+		return nil, errors.Wrapf(err, "failed to check for existing wallet %q", name)
+	}
+
+	id, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
 	}
-	ks.publicKey = blsPubKey
 
-	if len(seed) != 64 {
-		return nil, errors.New("seed must be 64 bytes")
+	ks := newKeyService()
+	ks.url = o.keyServiceURL
+	ks.publicKey = o.keyServicePublicKey
+	ks.protocol = o.keyServiceProtocol
+	ks.client = client
+
+	seed := o.seed
+	if o.seedGenerated {
+		defer zeroize(seed)
 	}
 	crypto, err := encryptor.Encrypt(seed, string(passphrase))
 	if err != nil {
@@ -204,10 +318,11 @@ func CreateWallet(ctx context.Context, name string, passphrase []byte, store e2w
 	}
 
 	// Decrypt to confirm it works.
-	_, err = encryptor.Decrypt(crypto, string(passphrase))
+	decrypted, err := encryptor.Decrypt(crypto, string(passphrase))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to decrypt seed")
 	}
+	zeroize(decrypted)
 
 	w := newWallet()
 	w.id = id
@@ -217,30 +332,82 @@ func CreateWallet(ctx context.Context, name string, passphrase []byte, store e2w
 	w.version = version
 	w.store = store
 	w.encryptor = encryptor
+	w.seedEncryptor = encryptor
 	w.keyService = ks
+	w.pathTemplate = o.pathTemplate
 
+	if err := w.storeAccountsIndex(); err != nil {
+		return nil, err
+	}
 	return w, w.storeWallet()
 }
 
 // OpenWallet opens an existing wallet with the given name.
-func OpenWallet(ctx context.Context, name string, store e2wtypes.Store, encryptor e2wtypes.Encryptor) (e2wtypes.Wallet, error) {
+// The WithHTTPClient(), WithTimeout() and WithTLSConfig() options configure the HTTP client used to communicate
+// with the key service; other options are stored with the wallet, and are rejected.
+func OpenWallet(ctx context.Context, name string, store e2wtypes.Store, encryptor e2wtypes.Encryptor, opts ...Option) (e2wtypes.Wallet, error) {
+	o, err := openOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.unverifiedRecovery {
+		return nil, &OptionError{Option: "WithUnverifiedRecovery", Err: errors.New("only supported when recovering a wallet")}
+	}
+	return openWallet(ctx, name, store, encryptor, o)
+}
+
+// openWallet opens an existing wallet with the given name, using the given options.
+func openWallet(ctx context.Context, name string, store e2wtypes.Store, encryptor e2wtypes.Encryptor, o *options) (e2wtypes.Wallet, error) {
+	client, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+
 	data, err := store.RetrieveWallet(name)
 	if err != nil {
-		return nil, errors.Wrapf(err, "wallet %q does not exist", name)
+		if isStoreNotFound(err) {
+			return nil, wrapError(ErrNotFound, err, fmt.Sprintf("wallet %q does not exist", name))
+		}
+		return nil, errors.Wrapf(err, "failed to retrieve wallet %q", name)
 	}
-	return DeserializeWallet(ctx, data, store, encryptor)
+	return deserializeWallet(ctx, data, store, encryptor, client)
 }
 
 // DeserializeWallet deserializes a wallet from its byte-level representation
-func DeserializeWallet(ctx context.Context, data []byte, store e2wtypes.Store, encryptor e2wtypes.Encryptor) (e2wtypes.Wallet, error) {
+// The options are as for OpenWallet().
+func DeserializeWallet(ctx context.Context, data []byte, store e2wtypes.Store, encryptor e2wtypes.Encryptor, opts ...Option) (e2wtypes.Wallet, error) {
+	o, err := openOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.unverifiedRecovery {
+		return nil, &OptionError{Option: "WithUnverifiedRecovery", Err: errors.New("only supported when recovering a wallet")}
+	}
+	client, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+	return deserializeWallet(ctx, data, store, encryptor, client)
+}
+
+// deserializeWallet deserializes a wallet, using the given HTTP client for the key service.
+func deserializeWallet(ctx context.Context, data []byte, store e2wtypes.Store, encryptor e2wtypes.Encryptor, client *http.Client) (e2wtypes.Wallet, error) {
 	wallet := newWallet()
+	wallet.encryptor = encryptor
 	if err := json.Unmarshal(data, wallet); err != nil {
-		return nil, errors.Wrap(err, "wallet corrupt")
+		if errors.Is(err, ErrUnsupportedVersion) {
+			return nil, err
+		}
+		return nil, wrapError(ErrCorruptData, err, "wallet corrupt")
 	}
 	wallet.store = store
-	wallet.encryptor = encryptor
+	wallet.keyService.client = client
+	if wallet.seedEncryptor == nil {
+		// Wallets that do not record the encryptor of their seed use that with which they are opened.
+		wallet.seedEncryptor = encryptor
+	}
 	if err := wallet.retrieveAccountsIndex(ctx); err != nil {
-		return nil, errors.Wrap(err, "wallet index corrupt")
+		return nil, wrapError(ErrCorruptData, err, "wallet index corrupt")
 	}
 
 	return wallet, nil
@@ -267,16 +434,13 @@ func (w *wallet) Version() uint {
 }
 
 // store stores the wallet in the store.
+// The accounts index is not stored; it is stored by storeAccountsIndex() when it changes.
 func (w *wallet) storeWallet() error {
 	data, err := json.Marshal(w)
 	if err != nil {
 		return err
 	}
 
-	if err := w.storeAccountsIndex(); err != nil {
-		return err
-	}
-
 	if err := w.store.StoreWallet(w.ID(), w.Name(), data); err != nil {
 		return err
 	}
@@ -287,29 +451,50 @@ func (w *wallet) storeWallet() error {
 // Lock locks the wallet.  A locked wallet cannot create new accounts.
 func (w *wallet) Lock(ctx context.Context) error {
 	w.mutex.Lock()
-	defer w.mutex.Unlock()
+	wasUnlocked := w.seed != nil
+	w.clearSeed()
+	w.autoLock.stop()
+	w.mutex.Unlock()
 
-	w.seed = nil
+	if wasUnlocked {
+		w.notifyLockEvent(&LockEvent{Reason: LockReasonExplicit})
+	}
 	return nil
 }
 
 // Unlock unlocks the wallet.  An unlocked wallet can create new accounts.
 func (w *wallet) Unlock(ctx context.Context, passphrase []byte) error {
 	w.mutex.Lock()
-	defer w.mutex.Unlock()
-
-	seed, err := w.encryptor.Decrypt(w.crypto, string(passphrase))
+	seed, err := w.seedEncryptor.Decrypt(w.crypto, string(passphrase))
 	if err != nil {
-		return errors.New("incorrect passphrase")
+		w.mutex.Unlock()
+		return newError(ErrIncorrectPassphrase, "incorrect passphrase")
+	}
+	wasLocked := w.seed == nil
+	if err := w.setSeed(seed); err != nil {
+		w.mutex.Unlock()
+		return err
 	}
-	w.seed = seed
+	w.autoLock.start()
+	w.mutex.Unlock()
 
+	if wasLocked {
+		w.notifyLockEvent(&LockEvent{Unlocked: true})
+	}
 	return nil
 }
 
 // IsUnlocked reports if the wallet is unlocked.
 func (w *wallet) IsUnlocked(ctx context.Context) (bool, error) {
-	return w.seed != nil, nil
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.isUnlocked(), nil
+}
+
+// isUnlocked reports if the wallet is unlocked.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) isUnlocked() bool {
+	return w.seed != nil
 }
 
 // CreateAccount creates a new account in the wallet.
@@ -319,21 +504,19 @@ func (w *wallet) CreateAccount(ctx context.Context, name string, passphrase []by
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
+	// Check before allocating the account number, so that attempts on a locked wallet do not leave gaps.
+	if !w.isUnlocked() {
+		return nil, newError(ErrLocked, "wallet must be unlocked to create accounts")
+	}
+
 	// Obtain the next available account.
 	// Although this should be nextAccount, it is possible that the user has created wallets with explicit
 	// paths that clash so we check here.
 	accountNum := w.nextAccount
 	var path string
 	for {
-		path = fmt.Sprintf("m/12381/3600/%d/0", accountNum)
-		found := false
-		for acc := range w.Accounts(ctx) {
-			if acc.(*account).Path() == path {
-				found = true
-				break
-			}
-		}
-		if !found {
+		path = fmt.Sprintf(w.pathTemplate, accountNum)
+		if _, exists := w.paths.ID(path); !exists {
 			break
 		}
 		accountNum++
@@ -370,31 +553,43 @@ func (w *wallet) CreatePathedAccount(ctx context.Context, path string, name stri
 // createPathedAccount creates a new account in the wallet with a given path.
 // This is an internal function, that assumes a lock is held on the wallet.
 func (w *wallet) createPathedAccount(ctx context.Context, path string, name string, passphrase []byte) (e2wtypes.Account, error) {
-	if name == "" {
-		return nil, errors.New("account name missing")
+	a, err := w.newPathedAccount(ctx, path, name, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	w.addToIndex(a)
+
+	if err := a.storeAccount(); err != nil {
+		return nil, err
 	}
-	if strings.HasPrefix(name, "_") {
-		return nil, fmt.Errorf("invalid account name %q", name)
+
+	return a, nil
+}
+
+// newPathedAccount generates a new account with a given path, without adding it to the wallet.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) newPathedAccount(ctx context.Context, path string, name string, passphrase []byte) (*account, error) {
+	if err := checkName("account", name); err != nil {
+		return nil, err
 	}
-	unlocked, err := w.IsUnlocked(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to obtain lock status")
+	if err := validatePath(path); err != nil {
+		return nil, err
 	}
-	if !unlocked {
-		return nil, errors.New("wallet must be unlocked to create accounts")
+	if !w.isUnlocked() {
+		return nil, newError(ErrLocked, "wallet must be unlocked to create accounts")
 	}
 
 	// Ensure that we don't already have an account with this name.
-	if _, err := w.AccountByName(ctx, name); err == nil {
-		return nil, fmt.Errorf("account with name %q already exists", name)
+	if _, err := w.accountByName(ctx, name); err == nil {
+		return nil, newErrorf(ErrAlreadyExists, "account with name %q already exists", name)
 	}
 
 	// Ensure that we don't already have an account with this path.
-	for acc := range w.Accounts(ctx) {
-		if acc.(*account).Path() == path {
-			return nil, fmt.Errorf("account with path %q already exists", path)
-		}
+	if _, exists := w.paths.ID(path); exists {
+		return nil, newErrorf(ErrAlreadyExists, "account with path %q already exists", path)
 	}
+	w.autoLock.touch()
 	// Generate the private key from the seed and next account
 	privateKey, err := util.PrivateKeyFromSeedAndPath(w.seed, path)
 	if err != nil {
@@ -408,7 +603,9 @@ func (w *wallet) createPathedAccount(ctx context.Context, path string, name stri
 	a.name = name
 	a.publicKey = privateKey.PublicKey()
 	// Encrypt the private key
-	a.crypto, err = w.encryptor.Encrypt(privateKey.Marshal(), string(passphrase))
+	secretBytes := privateKey.Marshal()
+	a.crypto, err = w.encryptor.Encrypt(secretBytes, string(passphrase))
+	zeroize(secretBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -418,25 +615,31 @@ func (w *wallet) createPathedAccount(ctx context.Context, path string, name stri
 	a.version = w.encryptor.Version()
 	a.wallet = w
 
-	w.index.Add(a.id, a.name)
-
-	if err := a.storeAccount(); err != nil {
-		return nil, err
-	}
-
 	return a, nil
 }
 
-// Accounts provides all accounts in the wallet.
+// Accounts provides all accounts in the wallet's store, including any that are missing from the wallet's index.
+// Accounts that cannot be decoded are skipped; use IterateAccounts() to obtain their errors.
+// The channel is closed when all accounts have been provided, or when the context is cancelled.
 func (w *wallet) Accounts(ctx context.Context) <-chan e2wtypes.Account {
+	w.mutex.RLock()
+	stored := w.retrieveStoredAccounts()
+	w.mutex.RUnlock()
+
 	ch := make(chan e2wtypes.Account, 1024)
 	go func() {
-		for data := range w.store.RetrieveAccounts(w.ID()) {
-			if a, err := deserializeAccount(w, data); err == nil {
-				ch <- a
+		defer close(ch)
+		for _, data := range stored {
+			a, err := deserializeAccount(w, data)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- a:
+			case <-ctx.Done():
+				return
 			}
 		}
-		close(ch)
 	}()
 	return ch
 }
@@ -448,14 +651,9 @@ func (w *wallet) Export(ctx context.Context, passphrase []byte) ([]byte, error)
 		Accounts []*account `json:"accounts"`
 	}
 
-	accounts := make([]*account, 0)
-	for acc := range w.Accounts(ctx) {
-		accounts = append(accounts, acc.(*account))
-	}
-
 	ext := &walletExt{
 		Wallet:   w,
-		Accounts: accounts,
+		Accounts: w.scanAccounts(),
 	}
 
 	data, err := json.Marshal(ext)
@@ -483,17 +681,27 @@ func Import(ctx context.Context, encryptedData []byte, passphrase []byte, store
 		return nil, err
 	}
 
-	ext.Wallet.mutex = new(sync.RWMutex)
+	ext.Wallet.autoLock = newAutoLock(ext.Wallet.autoLocked)
 	ext.Wallet.index = indexer.New()
+	ext.Wallet.paths = newPathIndex()
+	ext.Wallet.pubKeys = newPublicKeyIndex()
+	ext.Wallet.flags = newFlagIndex()
 	ext.Wallet.store = store
 	ext.Wallet.encryptor = encryptor
+	if ext.Wallet.seedEncryptor == nil ||
+		(ext.Wallet.seedEncryptor.Name() == encryptor.Name() && ext.Wallet.seedEncryptor.Version() == encryptor.Version()) {
+		ext.Wallet.seedEncryptor = encryptor
+	}
 
 	// See if the wallet already exists
 	if _, err := OpenWallet(ctx, ext.Wallet.Name(), store, encryptor); err == nil {
-		return nil, fmt.Errorf("wallet %q already exists", ext.Wallet.Name())
+		return nil, newErrorf(ErrAlreadyExists, "wallet %q already exists", ext.Wallet.Name())
 	}
 
 	// Create the wallet
+	if err := ext.Wallet.storeAccountsIndex(); err != nil {
+		return nil, fmt.Errorf("failed to store wallet %q", ext.Wallet.Name())
+	}
 	if err := ext.Wallet.storeWallet(); err != nil {
 		return nil, fmt.Errorf("failed to store wallet %q", ext.Wallet.Name())
 	}
@@ -501,14 +709,20 @@ func Import(ctx context.Context, encryptedData []byte, passphrase []byte, store
 	// Create the accounts
 	for _, acc := range ext.Accounts {
 		acc.wallet = ext.Wallet
-		acc.encryptor = encryptor
-		acc.mutex = new(sync.RWMutex)
-		ext.Wallet.index.Add(acc.id, acc.name)
+		// Accounts keep the encryptor that protected them, preferring the supplied encryptor if it is that one.
+		if acc.encryptor.Name() == encryptor.Name() && acc.version == encryptor.Version() {
+			acc.encryptor = encryptor
+		}
+		acc.autoLock = newAutoLock(acc.autoLocked)
+		if !acc.local {
+			acc.keyService = ext.Wallet.keyService
+		}
+		// The index is stored along with each account.
+		ext.Wallet.addToIndex(acc)
 		if err := acc.storeAccount(); err != nil {
 			return nil, fmt.Errorf("failed to store account %q", acc.Name())
 		}
 	}
-	// Store the index.
 
 	return ext.Wallet, nil
 }
@@ -516,34 +730,105 @@ func Import(ctx context.Context, encryptedData []byte, passphrase []byte, store
 // AccountByName provides a single account from the wallet given its name.
 // This will error if the account is not found.
 func (w *wallet) AccountByName(ctx context.Context, name string) (e2wtypes.Account, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.accountByName(ctx, name)
+}
+
+// accountByName provides a single account from the wallet given its name.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) accountByName(ctx context.Context, name string) (e2wtypes.Account, error) {
 	if strings.HasPrefix(name, "m/") {
 		// Programmatic name
 		return w.programmaticAccount(name)
 	}
 	id, exists := w.index.ID(name)
 	if !exists {
-		return nil, fmt.Errorf("no account with name %q", name)
+		return nil, newErrorf(ErrNotFound, "no account with name %q", name)
 	}
-	return w.AccountByID(ctx, id)
+	return w.accountByID(ctx, id)
 }
 
 // AcountByID provides a single account from the wallet given its ID.
 // This will error if the account is not found.
 func (w *wallet) AccountByID(ctx context.Context, id uuid.UUID) (e2wtypes.Account, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.accountByID(ctx, id)
+}
+
+// accountByID provides a single account from the wallet given its ID.
+// This is an internal function, that assumes a lock is held on the wallet.
+func (w *wallet) accountByID(ctx context.Context, id uuid.UUID) (e2wtypes.Account, error) {
 	data, err := w.store.RetrieveAccount(w.id, id)
 	if err != nil {
+		if isStoreNotFound(err) {
+			return nil, markError(ErrNotFound, err)
+		}
 		return nil, err
 	}
 	return deserializeAccount(w, data)
 }
 
+// AccountByPublicKey provides a single account from the wallet given its public key.
+// The public key can be either the aggregate public key of the account, as used by the beacon chain, or its local
+// public key.
+// This will error if the account is not found.
+func (w *wallet) AccountByPublicKey(ctx context.Context, pubKey []byte) (e2wtypes.Account, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	id, exists := w.pubKeys.ID(pubKey)
+	if !exists {
+		return nil, newErrorf(ErrNotFound, "no account with public key %#x", pubKey)
+	}
+	return w.accountByID(ctx, id)
+}
+
 // Store returns the wallet's store.
 func (w *wallet) Store() e2wtypes.Store {
 	return w.store
 }
 
+// KeyServiceURL returns the URL of the wallet's key service.
+func (w *wallet) KeyServiceURL() string {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.keyService.url.String()
+}
+
+// SetKeyServiceURL sets the URL of the wallet's key service, for example if the key service has moved.
+// The key service's public key is unchanged.  The wallet must be unlocked.
+func (w *wallet) SetKeyServiceURL(ctx context.Context, keyServiceURL string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.isUnlocked() {
+		return newError(ErrLocked, "wallet must be unlocked to set key service URL")
+	}
+	url, err := url.Parse(keyServiceURL)
+	if err != nil {
+		return err
+	}
+	if url.Scheme == "" || url.Host == "" {
+		return fmt.Errorf("invalid key service URL %q", keyServiceURL)
+	}
+
+	w.keyService.url = url
+	return w.storeWallet()
+}
+
 // programmaticAccount calculates an account on the fly given its path.
+// The account is unlocked with an empty passphrase, and is not stored in the wallet.
+// This is an internal function, that assumes a lock is held on the wallet.
 func (w *wallet) programmaticAccount(path string) (e2wtypes.Account, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	if !w.isUnlocked() {
+		return nil, newError(ErrLocked, "wallet must be unlocked to calculate accounts")
+	}
+	w.autoLock.touch()
 	privateKey, err := util.PrivateKeyFromSeedAndPath(w.seed, path)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create private key for path %q", path)
@@ -558,13 +843,22 @@ func (w *wallet) programmaticAccount(path string) (e2wtypes.Account, error) {
 	a.publicKey = privateKey.PublicKey()
 	a.secretKey = privateKey
 	// Encrypt the private key with an empty passphrase
-	a.crypto, err = w.encryptor.Encrypt(privateKey.Marshal(), "")
+	secretBytes := privateKey.Marshal()
+	a.crypto, err = w.encryptor.Encrypt(secretBytes, "")
+	zeroize(secretBytes)
 	if err != nil {
 		return nil, err
 	}
+	// The remote share is that of the wallet's key service, as for stored accounts with the same path.
+	a.keyService = w.keyService
 	a.encryptor = w.encryptor
 	a.version = w.encryptor.Version()
 	a.wallet = w
+	// Programmatic accounts are not tracked in the wallet's unlocked accounts, as they have a fresh ID on each call and
+	// are never stored, so cannot be deleted or archived.
+	a.programmatic = true
+	a.autoLock.inherit(w.accountsAutoLock())
+	a.autoLock.start()
 
 	return a, nil
 }
@@ -575,30 +869,74 @@ func (w *wallet) retrieveAccountsIndex(ctx context.Context) error {
 	if err != nil {
 		// Attempt to recreate the index.
 		w.index = indexer.New()
-		for account := range w.Accounts(ctx) {
-			w.index.Add(account.ID(), account.Name())
+		w.paths = newPathIndex()
+		w.pubKeys = newPublicKeyIndex()
+		w.flags = newFlagIndex()
+		w.indexData = nil
+		for _, acc := range w.scanAccounts() {
+			w.index.Add(acc.id, acc.name)
+			w.paths.Add(acc.id, acc.path)
+			w.pubKeys.Add(acc.id, acc.publicKeys())
+			w.flags.Add(acc.id, acc.flags())
 		}
 		if err := w.storeAccountsIndex(); err != nil {
 			return err
 		}
 	} else {
-		index, err := indexer.Deserialize(serializedIndex)
+		index, paths, pubKeys, flags, complete, err := deserializeIndex(serializedIndex)
 		if err != nil {
 			return err
 		}
 		w.index = index
+		w.paths = paths
+		w.pubKeys = pubKeys
+		w.flags = flags
+		w.indexData = nil
+		if !complete {
+			// The index was stored without paths, public keys or flags; recreate them.  They will be stored with the
+			// next update.  Flags already in the index are kept for accounts that cannot be decoded.
+			w.paths = newPathIndex()
+			w.pubKeys = newPublicKeyIndex()
+			for _, acc := range w.scanAccounts() {
+				w.paths.Add(acc.id, acc.path)
+				w.pubKeys.Add(acc.id, acc.publicKeys())
+				w.flags.Add(acc.id, acc.flags())
+			}
+		}
 	}
 	return nil
 }
 
+// isStoreNotFound returns true if an error from a store is due to the item not existing.
+// Errors that are os.ErrNotExist, as are those of the stores in this module, are checked by type, as are other errors
+// of known types.  Other stores do not have typed errors, so the remainder are checked by their messages.
+func isStoreNotFound(err error) bool {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrNotFound) {
+		return true
+	}
+	var pathErr *os.PathError
+	var walletErr *walletError
+	if errors.As(err, &pathErr) || errors.As(err, &walletErr) {
+		return false
+	}
+	return strings.Contains(err.Error(), "not found")
+}
+
 // storeAccountsIndex stores the accounts index for a wallet.
 func (w *wallet) storeAccountsIndex() error {
-	serializedIndex, err := w.index.Serialize()
-	if err != nil {
-		return err
+	if w.indexData == nil {
+		serializedIndex, err := serializeIndex(w.index, w.paths, w.pubKeys, w.flags)
+		if err != nil {
+			return err
+		}
+		w.indexData = serializedIndex
 	}
-	if err := w.store.StoreAccountsIndex(w.id, serializedIndex); err != nil {
+	// The store is given a copy, as stores can retain the data they are given and addToIndex() appends to the cached
+	// index in place.
+	data := make([]byte, len(w.indexData))
+	copy(data, w.indexData)
+	if err := w.store.StoreAccountsIndex(w.id, data); err != nil {
 		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
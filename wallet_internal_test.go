@@ -15,6 +15,7 @@
 package mpc
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -172,3 +173,18 @@ func TestUnmarshalWallet(t *testing.T) {
 		})
 	}
 }
+
+func TestProgrammaticAccountsUntracked(t *testing.T) {
+	ctx := context.Background()
+	w, _ := _memoryWallet(t)
+	require.NoError(t, w.Unlock(ctx, []byte("wallet passphrase")))
+
+	for i := 0; i < 3; i++ {
+		a, err := w.AccountByName(ctx, "m/12381/3600/1/0")
+		require.NoError(t, err)
+		require.NoError(t, a.(*account).Lock(ctx))
+		require.NoError(t, a.(*account).Unlock(ctx, nil))
+	}
+	assert.Empty(t, w.unlockedAccounts)
+	assert.Empty(t, w.retiredAccounts)
+}
@@ -19,10 +19,10 @@ import (
 	"testing"
 
 	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
-	scratch "github.com/wealdtech/go-eth2-wallet-store-scratch"
 	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
 )
 
@@ -162,4 +162,37 @@ func TestCreateWallet(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestSetKeyServiceURL(t *testing.T) {
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+	require.NoError(t, err)
+
+	type keyServiceURLSetter interface {
+		KeyServiceURL() string
+		SetKeyServiceURL(ctx context.Context, keyServiceURL string) error
+	}
+	setter, isSetter := wallet.(keyServiceURLSetter)
+	require.True(t, isSetter)
+
+	err = setter.SetKeyServiceURL(context.Background(), "http://localhost:9000")
+	require.EqualError(t, err, "wallet must be unlocked to set key service URL")
+
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	err = setter.SetKeyServiceURL(context.Background(), "localhost")
+	require.EqualError(t, err, `invalid key service URL "localhost"`)
+	require.NoError(t, setter.SetKeyServiceURL(context.Background(), "http://localhost:9000"))
+	assert.Equal(t, "http://localhost:9000", setter.KeyServiceURL())
+
+	reopened, err := mpc.OpenWallet(context.Background(), "test wallet", store, encryptor)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9000", reopened.(keyServiceURLSetter).KeyServiceURL())
+}
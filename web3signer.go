@@ -0,0 +1,92 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Web3Signer request types for the objects signed by accounts.
+const (
+	web3SignerTypeDeposit       = "DEPOSIT"
+	web3SignerTypeVoluntaryExit = "VOLUNTARY_EXIT"
+)
+
+// web3SignerRequestKey is the context key for Web3Signer request details.
+type web3SignerRequestKey struct{}
+
+// Web3SignerRequest contains the details of a signing request required by key services that use
+// the Web3Signer protocol, in addition to the signing root.
+type Web3SignerRequest struct {
+	// Type is the type of the request, for example "ATTESTATION" or "BLOCK_V2".
+	Type string
+	// ForkInfo is the JSON fork information for the request, if required by the type.
+	ForkInfo json.RawMessage
+	// Fields are any additional JSON fields for the request, for example the object being signed.
+	Fields map[string]json.RawMessage
+}
+
+// WithWeb3SignerRequest returns a context that supplies the details of a Web3Signer signing request.
+// Accounts whose key service uses the Web3Signer protocol can only sign with a context that holds these details.
+func WithWeb3SignerRequest(ctx context.Context, request *Web3SignerRequest) context.Context {
+	return context.WithValue(ctx, web3SignerRequestKey{}, request)
+}
+
+// depositRequest creates the Web3Signer request for a deposit message.
+func depositRequest(message *depositMessage, genesisForkVersion []byte) (*Web3SignerRequest, error) {
+	deposit, err := json.Marshal(map[string]string{
+		"pubkey":                 fmt.Sprintf("%#x", message.PublicKey),
+		"withdrawal_credentials": fmt.Sprintf("%#x", message.WithdrawalCredentials),
+		"amount":                 fmt.Sprintf("%d", message.Amount),
+		"genesis_fork_version":   fmt.Sprintf("%#x", genesisForkVersion),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Web3SignerRequest{
+		Type:   web3SignerTypeDeposit,
+		Fields: map[string]json.RawMessage{"deposit": deposit},
+	}, nil
+}
+
+// voluntaryExitRequest creates the Web3Signer request for a voluntary exit.
+// Web3Signer selects the fork version from the fork information by the epoch of the exit, so both versions of the
+// fork are the supplied version.
+func voluntaryExitRequest(validatorIndex uint64, epoch uint64, forkVersion []byte, genesisValidatorsRoot []byte) (*Web3SignerRequest, error) {
+	forkInfo, err := json.Marshal(map[string]interface{}{
+		"fork": map[string]string{
+			"previous_version": fmt.Sprintf("%#x", forkVersion),
+			"current_version":  fmt.Sprintf("%#x", forkVersion),
+			"epoch":            "0",
+		},
+		"genesis_validators_root": fmt.Sprintf("%#x", genesisValidatorsRoot),
+	})
+	if err != nil {
+		return nil, err
+	}
+	exit, err := json.Marshal(&VoluntaryExit{
+		Epoch:          fmt.Sprintf("%d", epoch),
+		ValidatorIndex: fmt.Sprintf("%d", validatorIndex),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Web3SignerRequest{
+		Type:     web3SignerTypeVoluntaryExit,
+		ForkInfo: forkInfo,
+		Fields:   map[string]json.RawMessage{"voluntary_exit": exit},
+	}, nil
+}
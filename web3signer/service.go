@@ -0,0 +1,281 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package web3signer provides a signing service compatible with the Web3Signer HTTP API, allowing
+// validator clients such as Lighthouse and Teku to sign with the accounts of MPC wallets.
+package web3signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/pkg/errors"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+const (
+	publicKeysPath = "/api/v1/eth2/publicKeys"
+	signPathPrefix = "/api/v1/eth2/sign/"
+	upcheckPath    = "/upcheck"
+
+	// maxRequestBodySize is the maximum size of the body of a signing request, which is ample for requests that
+	// contain beacon blocks.
+	maxRequestBodySize = 10 * 1024 * 1024
+)
+
+// slashableTypes are the types of signing request that can lead to slashing.
+var slashableTypes = map[string]bool{
+	"ATTESTATION": true,
+	"BLOCK":       true,
+	"BLOCK_V2":    true,
+}
+
+// signingAccount is the interface for accounts served by the service.
+type signingAccount interface {
+	e2wtypes.AccountPublicKeyProvider
+	e2wtypes.AccountSigner
+}
+
+// Service is a Web3Signer-compatible signing service.
+// Accounts are identified by their aggregate public key, which is the key known to the beacon chain.
+type Service struct {
+	accounts   map[string]signingAccount
+	publicKeys []string
+	// unprotectedSigning is true if requests that can lead to slashing are signed.
+	unprotectedSigning bool
+}
+
+// Option is an option for the creation of a service.
+type Option interface {
+	apply(*Service)
+}
+
+type optionFunc func(*Service)
+
+func (f optionFunc) apply(s *Service) {
+	f(s)
+}
+
+// WithUnprotectedSigning allows the service to sign blocks and attestations, and requests without a type.
+// The service has no slashing protection, so this must only be used if the validator client provides it and the
+// accounts are not in use elsewhere.
+func WithUnprotectedSigning() Option {
+	return optionFunc(func(s *Service) {
+		s.unprotectedSigning = true
+	})
+}
+
+// signResponse is the JSON response to a Web3Signer signing request.
+type signResponse struct {
+	Signature string `json:"signature"`
+}
+
+// New creates a new signing service for the accounts in the supplied wallets.
+// Each account is unlocked with the first of the passphrases that succeeds; accounts that cannot be unlocked
+// are not served.
+// The service does not have slashing protection, so by default refuses to sign blocks and attestations, and requests
+// without a type; see WithUnprotectedSigning().
+func New(ctx context.Context, wallets []e2wtypes.Wallet, passphrases [][]byte, opts ...Option) (*Service, error) {
+	s := &Service{
+		accounts:   make(map[string]signingAccount),
+		publicKeys: make([]string, 0),
+	}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+	for _, wallet := range wallets {
+		for account := range wallet.Accounts(ctx) {
+			locker, isLocker := account.(e2wtypes.AccountLocker)
+			signer, isSigner := account.(signingAccount)
+			if !isLocker || !isSigner {
+				continue
+			}
+			unlocked := false
+			for _, passphrase := range passphrases {
+				if err := locker.Unlock(ctx, passphrase); err == nil {
+					unlocked = true
+					break
+				}
+			}
+			if !unlocked {
+				continue
+			}
+			publicKey := signer.PublicKey()
+			if publicKey == nil {
+				return nil, fmt.Errorf("failed to obtain public key for account %q", account.Name())
+			}
+			key := fmt.Sprintf("%#x", publicKey.Marshal())
+			if _, exists := s.accounts[key]; exists {
+				continue
+			}
+			s.accounts[key] = signer
+			s.publicKeys = append(s.publicKeys, key)
+		}
+	}
+	if len(s.accounts) == 0 {
+		return nil, errors.New("no accounts unlocked")
+	}
+	sort.Strings(s.publicKeys)
+
+	return s, nil
+}
+
+// PassphrasesFromFiles reads passphrases from the given files, one passphrase per file.
+// Trailing newlines are removed.
+func PassphrasesFromFiles(paths []string) ([][]byte, error) {
+	passphrases := make([][]byte, len(paths))
+	for i, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read passphrase file %s", path)
+		}
+		passphrases[i] = bytes.TrimRight(data, "\r\n")
+	}
+	return passphrases, nil
+}
+
+// PublicKeys returns the public keys of the accounts served, as 0x-prefixed hex strings.
+func (s *Service) PublicKeys() []string {
+	publicKeys := make([]string, len(s.publicKeys))
+	copy(publicKeys, s.publicKeys)
+	return publicKeys
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Service) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == upcheckPath:
+		if req.Method != http.MethodGet {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.Write([]byte("OK"))
+	case req.URL.Path == publicKeysPath:
+		if req.Method != http.MethodGet {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.servePublicKeys(rw)
+	case strings.HasPrefix(req.URL.Path, signPathPrefix):
+		if req.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveSign(rw, req, strings.TrimPrefix(req.URL.Path, signPathPrefix))
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+// servePublicKeys serves the list of public keys.
+func (s *Service) servePublicKeys(rw http.ResponseWriter) {
+	data, err := json.Marshal(s.publicKeys)
+	if err != nil {
+		http.Error(rw, "failed to marshal public keys", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(data)
+}
+
+// serveSign serves a signing request for the account with the given identifier.
+func (s *Service) serveSign(rw http.ResponseWriter, req *http.Request, identifier string) {
+	identifier = strings.ToLower(identifier)
+	if !strings.HasPrefix(identifier, "0x") {
+		identifier = "0x" + identifier
+	}
+	account, exists := s.accounts[identifier]
+	if !exists {
+		http.Error(rw, fmt.Sprintf("public key %s not found", identifier), http.StatusNotFound)
+		return
+	}
+
+	// The service signs the signing root supplied by the validator client.  The remaining fields are passed on
+	// in case the account's key service is itself a Web3Signer instance.
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxRequestBodySize+1))
+	if err != nil {
+		http.Error(rw, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRequestBodySize {
+		http.Error(rw, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &fields); err != nil {
+		http.Error(rw, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	var signingRoot string
+	if err := json.Unmarshal(fields["signingRoot"], &signingRoot); err != nil || signingRoot == "" {
+		http.Error(rw, "signing root missing", http.StatusBadRequest)
+		return
+	}
+	root, err := hex.DecodeString(strings.TrimPrefix(signingRoot, "0x"))
+	if err != nil || len(root) != 32 {
+		http.Error(rw, "signing root invalid", http.StatusBadRequest)
+		return
+	}
+	request := &mpc.Web3SignerRequest{
+		ForkInfo: fields["fork_info"],
+		Fields:   fields,
+	}
+	// Type is optional here if unprotected signing is allowed, as it is otherwise only needed by Web3Signer key
+	// services.
+	_ = json.Unmarshal(fields["type"], &request.Type)
+	if !s.unprotectedSigning {
+		if request.Type == "" {
+			http.Error(rw, "type missing", http.StatusBadRequest)
+			return
+		}
+		if slashableTypes[request.Type] {
+			// Web3Signer responds to requests refused by its slashing protection with this status.
+			http.Error(rw, fmt.Sprintf("signing of %s requests is not allowed without slashing protection", request.Type), http.StatusPreconditionFailed)
+			return
+		}
+	}
+	delete(fields, "type")
+	delete(fields, "fork_info")
+	delete(fields, "signingRoot")
+	ctx := mpc.WithWeb3SignerRequest(req.Context(), request)
+
+	signature, err := account.Sign(ctx, root)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("failed to sign: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	signatureStr := fmt.Sprintf("%#x", signature.Marshal())
+	if strings.Contains(req.Header.Get("Accept"), "application/json") {
+		data, err := json.Marshal(&signResponse{Signature: signatureStr})
+		if err != nil {
+			http.Error(rw, "failed to marshal signature", http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(data)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain")
+	rw.Write([]byte(signatureStr))
+}
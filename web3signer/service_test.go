@@ -0,0 +1,320 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web3signer_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/web3signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// _keyService is a helper to start a key service that signs with the supplied private key.
+func _keyService(t *testing.T, privateKey e2types.PrivateKey) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var request struct {
+			Payload string `json:"payload"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		payload, err := hex.DecodeString(request.Payload)
+		require.NoError(t, err)
+		rw.Write([]byte(fmt.Sprintf(`{"sign":"%x"}`, privateKey.Sign(payload).Marshal())))
+	}))
+}
+
+// _wallet is a helper to create a wallet with the named accounts, all with the passphrase "account passphrase".
+func _wallet(t *testing.T, keyServiceURL string, remoteKey e2types.PrivateKey, accountNames ...string) (e2wtypes.Wallet, []e2wtypes.Account) {
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), scratch.New(), keystorev4.New(), seed, keyServiceURL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	accounts := make([]e2wtypes.Account, len(accountNames))
+	for i, name := range accountNames {
+		accounts[i], err = wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), name, []byte("account passphrase"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Lock(context.Background()))
+	return wallet, accounts
+}
+
+func TestMain(m *testing.M) {
+	if err := e2types.InitBLS(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestNew(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+	wallet, _ := _wallet(t, keyService.URL, remoteKey, "Test")
+
+	_, err = web3signer.New(context.Background(), []e2wtypes.Wallet{wallet}, [][]byte{[]byte("bad passphrase")})
+	assert.EqualError(t, err, "no accounts unlocked")
+
+	service, err := web3signer.New(context.Background(), []e2wtypes.Wallet{wallet}, [][]byte{[]byte("bad passphrase"), []byte("account passphrase")})
+	require.NoError(t, err)
+	assert.Len(t, service.PublicKeys(), 1)
+}
+
+func TestServeHTTP(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+	wallet, accounts := _wallet(t, keyService.URL, remoteKey, "Test1", "Test2")
+
+	service, err := web3signer.New(context.Background(), []e2wtypes.Wallet{wallet}, [][]byte{[]byte("account passphrase")}, web3signer.WithUnprotectedSigning())
+	require.NoError(t, err)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	publicKey := accounts[0].(e2wtypes.AccountPublicKeyProvider).PublicKey()
+	signingRoot := "0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		accept      string
+		body        string
+		status      int
+		contentType string
+	}{
+		{
+			name:   "Upcheck",
+			method: http.MethodGet,
+			path:   "/upcheck",
+			status: http.StatusOK,
+		},
+		{
+			name:        "PublicKeys",
+			method:      http.MethodGet,
+			path:        "/api/v1/eth2/publicKeys",
+			status:      http.StatusOK,
+			contentType: "application/json",
+		},
+		{
+			name:   "PublicKeysBadMethod",
+			method: http.MethodPost,
+			path:   "/api/v1/eth2/publicKeys",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "UnknownPath",
+			method: http.MethodGet,
+			path:   "/api/v1/eth2/unknown",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "SignUnknownKey",
+			method: http.MethodPost,
+			path:   fmt.Sprintf("/api/v1/eth2/sign/0x%096x", 0),
+			body:   fmt.Sprintf(`{"type":"ATTESTATION","signingRoot":"%s"}`, signingRoot),
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "SignBadBody",
+			method: http.MethodPost,
+			path:   fmt.Sprintf("/api/v1/eth2/sign/%#x", publicKey.Marshal()),
+			body:   `bad`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "SignSigningRootMissing",
+			method: http.MethodPost,
+			path:   fmt.Sprintf("/api/v1/eth2/sign/%#x", publicKey.Marshal()),
+			body:   `{"type":"ATTESTATION"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "SignSigningRootShort",
+			method: http.MethodPost,
+			path:   fmt.Sprintf("/api/v1/eth2/sign/%#x", publicKey.Marshal()),
+			body:   `{"type":"ATTESTATION","signingRoot":"0x0102"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:        "Sign",
+			method:      http.MethodPost,
+			path:        fmt.Sprintf("/api/v1/eth2/sign/%#x", publicKey.Marshal()),
+			body:        fmt.Sprintf(`{"type":"ATTESTATION","signingRoot":"%s"}`, signingRoot),
+			status:      http.StatusOK,
+			contentType: "text/plain",
+		},
+		{
+			name:        "SignJSON",
+			method:      http.MethodPost,
+			path:        fmt.Sprintf("/api/v1/eth2/sign/%#x", publicKey.Marshal()),
+			accept:      "application/json",
+			body:        fmt.Sprintf(`{"type":"ATTESTATION","signingRoot":"%s"}`, signingRoot),
+			status:      http.StatusOK,
+			contentType: "application/json",
+		},
+		{
+			name:        "SignNoPrefix",
+			method:      http.MethodPost,
+			path:        fmt.Sprintf("/api/v1/eth2/sign/%X", publicKey.Marshal()),
+			body:        fmt.Sprintf(`{"type":"ATTESTATION","signingRoot":"%s"}`, signingRoot),
+			status:      http.StatusOK,
+			contentType: "text/plain",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+			require.NoError(t, err)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, test.status, resp.StatusCode, string(body))
+			if test.contentType != "" {
+				assert.Equal(t, test.contentType, resp.Header.Get("Content-Type"))
+			}
+			switch test.contentType {
+			case "application/json":
+				if strings.HasSuffix(test.path, "publicKeys") {
+					var publicKeys []string
+					require.NoError(t, json.Unmarshal(body, &publicKeys))
+					assert.ElementsMatch(t, service.PublicKeys(), publicKeys)
+					assert.Contains(t, publicKeys, fmt.Sprintf("%#x", publicKey.Marshal()))
+				} else {
+					var response struct {
+						Signature string `json:"signature"`
+					}
+					require.NoError(t, json.Unmarshal(body, &response))
+					body = []byte(response.Signature)
+				}
+			}
+			if test.status == http.StatusOK && strings.Contains(test.path, "/sign/") {
+				signatureBytes, err := hex.DecodeString(strings.TrimPrefix(string(body), "0x"))
+				require.NoError(t, err)
+				signature, err := e2types.BLSSignatureFromBytes(signatureBytes)
+				require.NoError(t, err)
+				root, err := hex.DecodeString(strings.TrimPrefix(signingRoot, "0x"))
+				require.NoError(t, err)
+				assert.True(t, signature.Verify(root, publicKey))
+			}
+		})
+	}
+}
+
+func TestServeHTTPProtected(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+	wallet, accounts := _wallet(t, keyService.URL, remoteKey, "Test1")
+
+	service, err := web3signer.New(context.Background(), []e2wtypes.Wallet{wallet}, [][]byte{[]byte("account passphrase")})
+	require.NoError(t, err)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	path := fmt.Sprintf("%s/api/v1/eth2/sign/%#x", server.URL, accounts[0].(e2wtypes.AccountPublicKeyProvider).PublicKey().Marshal())
+	signingRoot := "0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{
+			name:   "TypeMissing",
+			body:   fmt.Sprintf(`{"signingRoot":"%s"}`, signingRoot),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Attestation",
+			body:   fmt.Sprintf(`{"type":"ATTESTATION","signingRoot":"%s"}`, signingRoot),
+			status: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "Block",
+			body:   fmt.Sprintf(`{"type":"BLOCK","signingRoot":"%s"}`, signingRoot),
+			status: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "BlockV2",
+			body:   fmt.Sprintf(`{"type":"BLOCK_V2","signingRoot":"%s"}`, signingRoot),
+			status: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "RandaoReveal",
+			body:   fmt.Sprintf(`{"type":"RANDAO_REVEAL","signingRoot":"%s"}`, signingRoot),
+			status: http.StatusOK,
+		},
+		{
+			name:   "TooLarge",
+			body:   fmt.Sprintf(`{"type":"RANDAO_REVEAL","signingRoot":"%s","padding":"%s"}`, signingRoot, strings.Repeat("0", 10*1024*1024)),
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := http.Post(path, "application/json", strings.NewReader(test.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, test.status, resp.StatusCode, string(body))
+		})
+	}
+}
+
+func TestPassphrasesFromFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestPassphrasesFromFiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "passphrase1"), []byte("passphrase 1\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "passphrase2"), []byte("passphrase 2"), 0600))
+
+	passphrases, err := web3signer.PassphrasesFromFiles([]string{filepath.Join(dir, "passphrase1"), filepath.Join(dir, "passphrase2")})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("passphrase 1"), []byte("passphrase 2")}, passphrases)
+
+	_, err = web3signer.PassphrasesFromFiles([]string{filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
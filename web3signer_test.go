@@ -0,0 +1,192 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// web3SignerStub is a Web3Signer stub that, as Web3Signer does, checks the signing root of each request against the
+// object in the request before signing it.
+type web3SignerStub struct {
+	*httptest.Server
+	mutex sync.Mutex
+	types []string
+}
+
+// _web3Signer is a helper to start a Web3Signer stub that signs with the given key.
+func _web3Signer(t *testing.T, privateKey e2types.PrivateKey) *web3SignerStub {
+	stub := &web3SignerStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, fmt.Sprintf("/api/v1/eth2/sign/%#x", privateKey.PublicKey().Marshal()), req.URL.Path)
+		var request struct {
+			Type        string `json:"type"`
+			SigningRoot string `json:"signingRoot"`
+			ForkInfo    *struct {
+				Fork struct {
+					PreviousVersion string `json:"previous_version"`
+					CurrentVersion  string `json:"current_version"`
+					Epoch           string `json:"epoch"`
+				} `json:"fork"`
+				GenesisValidatorsRoot string `json:"genesis_validators_root"`
+			} `json:"fork_info"`
+			Deposit *struct {
+				PublicKey             string `json:"pubkey"`
+				WithdrawalCredentials string `json:"withdrawal_credentials"`
+				Amount                string `json:"amount"`
+				GenesisForkVersion    string `json:"genesis_fork_version"`
+			} `json:"deposit"`
+			VoluntaryExit *mpc.VoluntaryExit `json:"voluntary_exit"`
+		}
+		if !assert.NoError(t, json.NewDecoder(req.Body).Decode(&request)) {
+			http.Error(rw, "bad request", http.StatusBadRequest)
+			return
+		}
+		stub.mutex.Lock()
+		stub.types = append(stub.types, request.Type)
+		stub.mutex.Unlock()
+
+		var signingRoot []byte
+		switch request.Type {
+		case "DEPOSIT":
+			if !assert.NotNil(t, request.Deposit) {
+				http.Error(rw, "deposit missing", http.StatusBadRequest)
+				return
+			}
+			amount, err := strconv.ParseUint(request.Deposit.Amount, 10, 64)
+			require.NoError(t, err)
+			signingRoot = _signingRoot(t, &struct {
+				PublicKey             []byte `ssz-size:"48"`
+				WithdrawalCredentials []byte `ssz-size:"32"`
+				Amount                uint64
+			}{
+				PublicKey:             _byteArray(strings.TrimPrefix(request.Deposit.PublicKey, "0x")),
+				WithdrawalCredentials: _byteArray(strings.TrimPrefix(request.Deposit.WithdrawalCredentials, "0x")),
+				Amount:                amount,
+			}, e2types.Domain(e2types.DomainDeposit, _byteArray(strings.TrimPrefix(request.Deposit.GenesisForkVersion, "0x")), e2types.ZeroGenesisValidatorsRoot))
+		case "VOLUNTARY_EXIT":
+			if !assert.NotNil(t, request.ForkInfo) || !assert.NotNil(t, request.VoluntaryExit) {
+				http.Error(rw, "fork info or voluntary exit missing", http.StatusBadRequest)
+				return
+			}
+			epoch, err := strconv.ParseUint(request.VoluntaryExit.Epoch, 10, 64)
+			require.NoError(t, err)
+			validatorIndex, err := strconv.ParseUint(request.VoluntaryExit.ValidatorIndex, 10, 64)
+			require.NoError(t, err)
+			forkEpoch, err := strconv.ParseUint(request.ForkInfo.Fork.Epoch, 10, 64)
+			require.NoError(t, err)
+			forkVersion := request.ForkInfo.Fork.CurrentVersion
+			if epoch < forkEpoch {
+				forkVersion = request.ForkInfo.Fork.PreviousVersion
+			}
+			signingRoot = _signingRoot(t, &struct {
+				Epoch          uint64
+				ValidatorIndex uint64
+			}{
+				Epoch:          epoch,
+				ValidatorIndex: validatorIndex,
+			}, e2types.Domain(e2types.DomainVoluntaryExit, _byteArray(strings.TrimPrefix(forkVersion, "0x")), _byteArray(strings.TrimPrefix(request.ForkInfo.GenesisValidatorsRoot, "0x"))))
+		default:
+			http.Error(rw, "unsupported type", http.StatusBadRequest)
+			return
+		}
+		if !assert.Equal(t, fmt.Sprintf("%#x", signingRoot), request.SigningRoot) {
+			http.Error(rw, "signing root mismatch", http.StatusBadRequest)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(fmt.Sprintf(`{"signature":"%#x"}`, privateKey.Sign(signingRoot).Marshal())))
+	}))
+	return stub
+}
+
+func TestWeb3SignerHelpers(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	web3Signer := _web3Signer(t, remoteKey)
+	defer web3Signer.Close()
+
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWalletWithOptions(context.Background(), "test wallet", []byte("wallet passphrase"), scratch.New(), keystorev4.New(),
+		mpc.WithKeyService(web3Signer.URL, remoteKey.PublicKey().Marshal()),
+		mpc.WithKeyServiceProtocol("web3signer"),
+		mpc.WithSeed(seed),
+	)
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+	account, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Test", []byte("account passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, account.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("account passphrase")))
+
+	forkVersion := []byte{0x03, 0x00, 0x00, 0x00}
+	genesisValidatorsRoot := _byteArray("4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95")
+
+	t.Run("Sign", func(t *testing.T) {
+		_, err := account.(e2wtypes.AccountSigner).Sign(context.Background(), []byte("test"))
+		require.EqualError(t, err, "web3signer request type missing")
+		assert.True(t, errors.Is(err, mpc.ErrUnsupportedRequest))
+	})
+
+	t.Run("DepositData", func(t *testing.T) {
+		depositData, err := account.(depositDataProvider).DepositData(context.Background(), _byteArray("00fad2a6bfb0e7f1f0f45460944fbd8dfa7f37da06a4d13b3983cc90bb46963b"), 32000000000, []byte{0x00, 0x00, 0x00, 0x00})
+		require.NoError(t, err)
+		assert.Len(t, depositData.Signature, 192)
+	})
+
+	t.Run("SignVoluntaryExit", func(t *testing.T) {
+		// A request for another type in the context is replaced.
+		ctx := mpc.WithWeb3SignerRequest(context.Background(), &mpc.Web3SignerRequest{Type: "ATTESTATION"})
+		exit, err := account.(operationsSigner).SignVoluntaryExit(ctx, 12345, 194048, forkVersion, genesisValidatorsRoot, true)
+		require.NoError(t, err)
+		root := _signingRoot(t, &struct {
+			Epoch          uint64
+			ValidatorIndex uint64
+		}{
+			Epoch:          194048,
+			ValidatorIndex: 12345,
+		}, e2types.Domain(e2types.DomainVoluntaryExit, forkVersion, genesisValidatorsRoot))
+		assert.True(t, _signature(t, exit.Signature).Verify(root, account.PublicKey()))
+	})
+
+	t.Run("SignBLSToExecutionChange", func(t *testing.T) {
+		_, err := account.(operationsSigner).SignBLSToExecutionChange(context.Background(), 12345, _byteArray("8c8e8f9c0a6c5c2f6e8e2d8b0c1a9e6d1f2b3c4d"), []byte{0x00, 0x00, 0x00, 0x00}, genesisValidatorsRoot, true)
+		require.EqualError(t, err, "web3signer key services cannot sign BLS to execution changes")
+		assert.True(t, errors.Is(err, mpc.ErrUnsupportedRequest))
+	})
+
+	// Only the supported requests reached the key service.
+	assert.Equal(t, []string{"DEPOSIT", "VOLUNTARY_EXIT"}, web3Signer.types)
+}
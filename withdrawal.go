@@ -0,0 +1,103 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+// CreateWithdrawalAccount creates the withdrawal account for an existing signing account.
+// The withdrawal account's path is the parent of the signing account's path, so for a signing account at
+// m/12381/3600/i/0 the withdrawal account is at m/12381/3600/i.
+// If local is true the withdrawal account is held entirely locally, otherwise it is protected by the
+// wallet's key service in the same way as the signing account.
+// The signing and withdrawal accounts are linked to each other in their metadata.
+func (w *wallet) CreateWithdrawalAccount(ctx context.Context, signingAccountName string, name string, passphrase []byte, local bool) (e2wtypes.Account, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if strings.HasPrefix(signingAccountName, "m/") {
+		return nil, errors.New("signing account must be a stored account")
+	}
+	acc, err := w.accountByName(ctx, signingAccountName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to obtain signing account %q", signingAccountName)
+	}
+	signingAccount := acc.(*account)
+	if signingAccount.signingAccount != uuid.Nil {
+		return nil, fmt.Errorf("account %q is a withdrawal account", signingAccountName)
+	}
+	if signingAccount.withdrawalAccount != uuid.Nil {
+		return nil, newErrorf(ErrAlreadyExists, "account %q already has a withdrawal account", signingAccountName)
+	}
+
+	path, err := withdrawalPath(signingAccount.path)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := w.newPathedAccount(ctx, path, name, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if local {
+		a.local = true
+		a.keyService = nil
+	}
+	a.signingAccount = signingAccount.id
+
+	// Link the signing account first, so that a withdrawal account is never stored without a link to it.
+	signingAccount.setWithdrawalAccount(a.id)
+	w.updateIndexFlags(signingAccount)
+	if err := signingAccount.storeAccount(); err != nil {
+		signingAccount.setWithdrawalAccount(uuid.Nil)
+		w.updateIndexFlags(signingAccount)
+		return nil, errors.Wrapf(err, "failed to link signing account %q", signingAccountName)
+	}
+
+	w.addToIndex(a)
+	if err := a.storeAccount(); err != nil {
+		w.removeFromIndex(a.id, a.name)
+		signingAccount.setWithdrawalAccount(uuid.Nil)
+		w.updateIndexFlags(signingAccount)
+		if unlinkErr := signingAccount.storeAccount(); unlinkErr != nil {
+			return nil, errors.Wrapf(err, "failed to store withdrawal account, and failed to unlink signing account %q: %v", signingAccountName, unlinkErr)
+		}
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// setWithdrawalAccount sets the ID of the withdrawal account for a signing account.
+func (a *account) setWithdrawalAccount(id uuid.UUID) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.withdrawalAccount = id
+}
+
+// withdrawalPath calculates the path of the withdrawal key for a signing key path.
+func withdrawalPath(signingPath string) (string, error) {
+	index := strings.LastIndex(signingPath, "/")
+	if index <= 1 {
+		return "", fmt.Errorf("signing account path %q has no parent", signingPath)
+	}
+	return signingPath[:index], nil
+}
@@ -0,0 +1,206 @@
+// Copyright © 2020 Staked Securely LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mpc_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	mpc "github.com/Stakedllc/go-eth2-wallet-mpc/v2"
+	"github.com/Stakedllc/go-eth2-wallet-mpc/v2/internal/scratch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	e2types "github.com/wealdtech/go-eth2-types/v2"
+	keystorev4 "github.com/wealdtech/go-eth2-wallet-encryptor-keystorev4"
+	e2wtypes "github.com/wealdtech/go-eth2-wallet-types/v2"
+)
+
+type withdrawalAccountCreator interface {
+	CreateWithdrawalAccount(ctx context.Context, signingAccountName string, name string, passphrase []byte, local bool) (e2wtypes.Account, error)
+}
+
+type withdrawalAccount interface {
+	IsLocal() bool
+	SigningAccountID() uuid.UUID
+	WithdrawalAccountID() uuid.UUID
+	WithdrawalCredentials() ([]byte, error)
+}
+
+func TestCreateWithdrawalAccount(t *testing.T) {
+	remoteKey, err := e2types.GenerateBLSPrivateKey()
+	require.NoError(t, err)
+	keyService := _keyService(t, remoteKey)
+	defer keyService.Close()
+
+	store := scratch.New()
+	encryptor := keystorev4.New()
+	seed := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+		0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+	}
+	wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, keyService.URL, remoteKey.PublicKey().Marshal())
+	require.NoError(t, err)
+	require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+
+	signing1, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Signing 1", []byte("account passphrase"))
+	require.NoError(t, err)
+	signing2, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Signing 2", []byte("account passphrase"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		signingAccount e2wtypes.Account
+		accountName    string
+		local          bool
+		path           string
+		err            string
+	}{
+		{
+			name:           "UnknownSigningAccount",
+			signingAccount: nil,
+			accountName:    "Withdrawal",
+			err:            `failed to obtain signing account "Unknown": no account with name "Unknown"`,
+		},
+		{
+			name:           "Local",
+			signingAccount: signing1,
+			accountName:    "Withdrawal 1",
+			local:          true,
+			path:           "m/12381/3600/0",
+		},
+		{
+			name:           "Duplicate",
+			signingAccount: signing1,
+			accountName:    "Withdrawal 1a",
+			err:            `account "Signing 1" already has a withdrawal account`,
+		},
+		{
+			name:           "MPC",
+			signingAccount: signing2,
+			accountName:    "Withdrawal 2",
+			path:           "m/12381/3600/1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signingAccountName := "Unknown"
+			if test.signingAccount != nil {
+				signingAccountName = test.signingAccount.Name()
+			}
+			account, err := wallet.(withdrawalAccountCreator).CreateWithdrawalAccount(context.Background(), signingAccountName, test.accountName, []byte("withdrawal passphrase"), test.local)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.path, account.(e2wtypes.AccountPathProvider).Path())
+			assert.Equal(t, test.local, account.(withdrawalAccount).IsLocal())
+			assert.Equal(t, test.signingAccount.ID(), account.(withdrawalAccount).SigningAccountID())
+
+			// Confirm the link is persisted on both accounts.
+			storedAccount, err := wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), account.ID())
+			require.NoError(t, err)
+			assert.Equal(t, test.local, storedAccount.(withdrawalAccount).IsLocal())
+			assert.Equal(t, test.signingAccount.ID(), storedAccount.(withdrawalAccount).SigningAccountID())
+			storedSigningAccount, err := wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), test.signingAccount.ID())
+			require.NoError(t, err)
+			assert.Equal(t, account.ID(), storedSigningAccount.(withdrawalAccount).WithdrawalAccountID())
+
+			// Confirm the withdrawal credentials.
+			withdrawalCredentials, err := storedAccount.(withdrawalAccount).WithdrawalCredentials()
+			require.NoError(t, err)
+			hash := sha256.Sum256(storedAccount.PublicKey().Marshal())
+			assert.Equal(t, byte(0x00), withdrawalCredentials[0])
+			assert.Equal(t, hash[1:], withdrawalCredentials[1:])
+
+			// Confirm the account can sign.
+			require.NoError(t, storedAccount.(e2wtypes.AccountLocker).Unlock(context.Background(), []byte("withdrawal passphrase")))
+			signature, err := storedAccount.(e2wtypes.AccountSigner).Sign(context.Background(), []byte("test"))
+			require.NoError(t, err)
+			assert.True(t, signature.Verify([]byte("test"), storedAccount.PublicKey()))
+		})
+	}
+}
+
+// failingAccountStore is a store that fails to store accounts whose data contains a given field.
+type failingAccountStore struct {
+	*scratch.Store
+	field string
+}
+
+func (s *failingAccountStore) StoreAccount(walletID uuid.UUID, accountID uuid.UUID, data []byte) error {
+	if strings.Contains(string(data), fmt.Sprintf("%q", s.field)) {
+		return errors.New("store failed")
+	}
+	return s.Store.StoreAccount(walletID, accountID, data)
+}
+
+func TestCreateWithdrawalAccountStoreFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		err   string
+	}{
+		{
+			name:  "SigningAccount",
+			field: "withdrawalaccount",
+			err:   `failed to link signing account "Signing": store failed`,
+		},
+		{
+			name:  "WithdrawalAccount",
+			field: "signingaccount",
+			err:   "store failed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &failingAccountStore{Store: scratch.New().(*scratch.Store), field: test.field}
+			encryptor := keystorev4.New()
+			seed := []byte{
+				0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+				0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+				0x20, 0x21, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f,
+				0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f,
+			}
+			pubkey := _byteArray("868630f2aa3d585ff470d29e17c35ac8c5393317724ea9f842395a061dc68c938ec426c74725242a63797bf517020fa2")
+			wallet, err := mpc.CreateWallet(context.Background(), "test wallet", []byte("wallet passphrase"), store, encryptor, seed, "http://localhost:8000", pubkey)
+			require.NoError(t, err)
+			require.NoError(t, wallet.(e2wtypes.WalletLocker).Unlock(context.Background(), []byte("wallet passphrase")))
+			signing, err := wallet.(e2wtypes.WalletAccountCreator).CreateAccount(context.Background(), "Signing", []byte("account passphrase"))
+			require.NoError(t, err)
+
+			_, err = wallet.(withdrawalAccountCreator).CreateWithdrawalAccount(context.Background(), "Signing", "Withdrawal", []byte("withdrawal passphrase"), true)
+			require.EqualError(t, err, test.err)
+
+			// Neither account is left with a link to the other.
+			storedSigningAccount, err := wallet.(e2wtypes.WalletAccountByIDProvider).AccountByID(context.Background(), signing.ID())
+			require.NoError(t, err)
+			assert.Equal(t, uuid.Nil, storedSigningAccount.(withdrawalAccount).WithdrawalAccountID())
+			_, err = wallet.(e2wtypes.WalletAccountByNameProvider).AccountByName(context.Background(), "Withdrawal")
+			assert.True(t, errors.Is(err, mpc.ErrNotFound))
+			for data := range store.RetrieveAccounts(wallet.ID()) {
+				assert.NotContains(t, string(data), "signingaccount")
+			}
+		})
+	}
+}